@@ -11,7 +11,7 @@ import (
 var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check mailbox and forward mails if needed",
-	RunE: func(cmd *cobra.Command, args []string) error {
+	PreRunE: func(cmd *cobra.Command, args []string) error {
 		if !viper.InConfig("imap") || !viper.InConfig("smtp") {
 			return fmt.Errorf(`configuration missing or incomplete.
 
@@ -24,7 +24,7 @@ The configuration file should be in your current directory and contain:
 - Email filter rules (which senders to monitor)
 - Recipients list (who receives forwarded emails)`)
 		}
-		return nil
+		return requireValidConfig()
 	},
 	Run: func(_ *cobra.Command, _ []string) {
 		if err := reflector.CheckAndForward(); err != nil {
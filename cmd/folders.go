@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var foldersCmd = &cobra.Command{
+	Use:   "folders",
+	Short: "List the folders of the IMAP server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !viper.InConfig("imap") {
+			return fmt.Errorf("IMAP configuration missing, create one with: mail-reflector init")
+		}
+
+		mailboxes, err := reflector.ListMailboxes()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mailboxes {
+			if len(m.Attributes) == 0 {
+				fmt.Println(m.Name)
+				continue
+			}
+			fmt.Printf("%s\t%s\n", m.Name, strings.Join(m.Attributes, " "))
+		}
+		return nil
+	},
+}
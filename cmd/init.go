@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/meko-christian/mail-reflector/internal/reflector"
 	"github.com/spf13/cobra"
 )
 
@@ -24,18 +25,30 @@ var initCmd = &cobra.Command{
 
 		fmt.Println("Let's set up your config.yaml!")
 
+		// Pre-fill the server settings from the provider's published autoconfig, if any
+		var auto reflector.Autoconfig
+		if email := prompt(reader, "Email address of the mailbox (empty to enter servers manually): "); email != "" {
+			fmt.Println("Looking up server settings...")
+			if found, err := reflector.LookupAutoconfig(cmd.Context(), email); err != nil {
+				fmt.Println("No server settings found, please enter them manually.")
+			} else {
+				auto = *found
+				fmt.Println("Found server settings, press Enter to accept the suggestions.")
+			}
+		}
+
 		fmt.Println("\n--- IMAP ---")
-		imapServer := prompt(reader, "IMAP server (e.g. imap.strato.de): ")
-		imapPort := prompt(reader, "IMAP port (e.g. 993): ")
-		imapSecurity := prompt(reader, "IMAP security (ssl/starttls): ")
-		imapUser := prompt(reader, "IMAP username: ")
+		imapServer := promptDefault(reader, "IMAP server (e.g. imap.strato.de)", auto.IMAP.Server)
+		imapPort := promptDefault(reader, "IMAP port (e.g. 993)", auto.IMAP.PortString())
+		imapSecurity := promptDefault(reader, "IMAP security (ssl/starttls)", auto.IMAP.Security)
+		imapUser := promptDefault(reader, "IMAP username", auto.IMAP.Username)
 		imapPass := prompt(reader, "IMAP password: ")
 
 		fmt.Println("\n--- SMTP ---")
-		smtpServer := prompt(reader, "SMTP server (e.g. smtp.strato.de): ")
-		smtpPort := prompt(reader, "SMTP port (e.g. 465): ")
-		smtpSecurity := prompt(reader, "SMTP security (ssl/starttls): ")
-		smtpUser := prompt(reader, "SMTP username: ")
+		smtpServer := promptDefault(reader, "SMTP server (e.g. smtp.strato.de)", auto.SMTP.Server)
+		smtpPort := promptDefault(reader, "SMTP port (e.g. 465)", auto.SMTP.PortString())
+		smtpSecurity := promptDefault(reader, "SMTP security (ssl/starttls)", auto.SMTP.Security)
+		smtpUser := promptDefault(reader, "SMTP username", auto.SMTP.Username)
 		smtpPass := prompt(reader, "SMTP password: ")
 
 		fmt.Println("\n--- FILTER ---")
@@ -87,6 +100,17 @@ func prompt(r *bufio.Reader, label string) string {
 	return strings.TrimSpace(text)
 }
 
+// promptDefault prompts for a value, suggesting def which is used if the answer is empty
+func promptDefault(r *bufio.Reader, label, def string) string {
+	if def == "" {
+		return prompt(r, label+": ")
+	}
+	if answer := prompt(r, fmt.Sprintf("%s [%s]: ", label, def)); answer != "" {
+		return answer
+	}
+	return def
+}
+
 func promptMulti(r *bufio.Reader, label string) []string {
 	raw := prompt(r, label)
 	parts := strings.Split(raw, ",")
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/meko-christian/mail-reflector/internal/reflector"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -30,6 +34,9 @@ func init() {
 	rootCmd.AddCommand(checkCmd)
 	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(foldersCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(webCmd)
 }
 
 func Execute() error {
@@ -51,6 +58,12 @@ func initConfig() {
 			slog.Error("Failed to read config", "error", err)
 		}
 	} else {
+		// A child process of a multi-account `serve` works on its account's settings
+		if err := reflector.SelectAccountFromEnv(); err != nil {
+			slog.Error("Failed to select account", "error", err)
+			os.Exit(1)
+		}
+
 		// Validate config after successful load
 		validateConfig()
 	}
@@ -79,12 +92,37 @@ func validateConfig() {
 		slog.Warn("No filter.from addresses configured - no emails will be processed")
 	}
 
+	if provider := viper.GetString("provider"); provider != "" && !reflector.IsKnownProvider(provider) {
+		slog.Warn("Unknown provider profile, falling back to generic",
+			"provider", provider,
+			"known_providers", reflector.KnownProviders())
+	}
+
+	for _, err := range reflector.ValidateFromMap() {
+		slog.Warn("Invalid forward.from_map entry", "error", err)
+	}
+
 	recipients := viper.GetStringSlice("recipients")
 	if len(recipients) == 0 {
 		slog.Warn("No recipients configured - forwarding will not work")
 	}
 }
 
+// requireValidConfig refuses to start a command on a config that would make forwarding fail,
+// printing every problem found
+func requireValidConfig() error {
+	errs := reflector.ValidateConfig()
+	if len(errs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "Invalid configuration:")
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "  - %v\n", err)
+	}
+	return fmt.Errorf("configuration has %d error(s)", len(errs))
+}
+
 func setupLogger() {
 	var level slog.Level
 	if viper.GetBool("verbose") {
@@ -97,5 +135,13 @@ func setupLogger() {
 		Level: level,
 	})
 
-	slog.SetDefault(slog.New(handler))
+	// Attach the configured `log.labels` (e.g. instance, env) to every log line
+	labels := viper.GetStringMapString("log.labels")
+	keys := slices.Sorted(maps.Keys(labels))
+	attrs := make([]any, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.String(key, labels[key]))
+	}
+
+	slog.SetDefault(slog.New(handler).With(attrs...))
 }
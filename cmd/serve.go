@@ -10,6 +10,7 @@ import (
 	"syscall"
 
 	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/meko-christian/mail-reflector/internal/web"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -18,6 +19,16 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Continuously watch mailbox and forward matching mails",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// With `accounts`, every account is served by its own child process
+		if reflector.HasAccounts() {
+			startWebServer(ctx)
+			slog.Info("Starting serve mode for multiple accounts")
+			return reflector.ServeAccounts(ctx)
+		}
+
 		if !viper.InConfig("imap") || !viper.InConfig("smtp") {
 			return fmt.Errorf(`configuration missing or incomplete.
 
@@ -31,14 +42,41 @@ The configuration file should be in your current directory and contain:
 - Recipients list (who receives forwarded emails)`)
 		}
 
-		slog.Info("Starting serve mode (watching mailbox)")
-		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-		defer stop()
+		if err := requireValidConfig(); err != nil {
+			return err
+		}
+
+		// Reload config changes (e.g. `enabled: false` to pause forwarding) without a restart
+		viper.WatchConfig()
+
+		// The child process of an account leaves the web endpoints to the supervising process
+		if !reflector.IsAccountProcess() {
+			startWebServer(ctx)
+		}
 
+		slog.Info("Starting serve mode (watching mailbox)")
 		return reflector.Serve(ctx)
 	},
 }
 
+// startWebServer starts the optional HTTP endpoints (e.g. /healthz for container probes)
+// in the background if `web.listen` is set
+func startWebServer(ctx context.Context) {
+	addr := viper.GetString("web.listen")
+	if addr == "" {
+		return
+	}
+	srv := web.NewServer(addr)
+	if password := srv.GeneratedPassword(); password != "" {
+		fmt.Fprintf(os.Stderr, "No web.username/web.password_hash configured, log in to the web UI as \"admin\" with this password (valid until restart): %s\n", password)
+	}
+	go func() {
+		if err := srv.Start(ctx); err != nil {
+			slog.Error("Web server failed", "addr", addr, "error", err)
+		}
+	}()
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 }
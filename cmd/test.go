@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Verify the IMAP and SMTP login without forwarding anything",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !viper.InConfig("imap") || !viper.InConfig("smtp") {
+			return fmt.Errorf("IMAP or SMTP configuration missing, create one with: mail-reflector init")
+		}
+		return nil
+	},
+	Run: func(_ *cobra.Command, _ []string) {
+		result := reflector.TestLogin()
+
+		imapServer := fmt.Sprintf("%s:%d", viper.GetString("imap.server"), viper.GetInt("imap.port"))
+		if result.IMAP.OK {
+			fmt.Printf("IMAP  ok      %s (INBOX: %d messages, %d unseen)\n", imapServer, result.Messages, result.Unseen)
+		} else {
+			fmt.Printf("IMAP  FAILED  %s: %s\n", imapServer, result.IMAP.Error)
+		}
+
+		smtpServer := fmt.Sprintf("%s:%d", viper.GetString("smtp.server"), viper.GetInt("smtp.port"))
+		if result.SMTP.OK {
+			fmt.Printf("SMTP  ok      %s\n", smtpServer)
+		} else {
+			fmt.Printf("SMTP  FAILED  %s: %s\n", smtpServer, result.SMTP.Error)
+		}
+
+		if !result.OK() {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/meko-christian/mail-reflector/internal/web"
+	"github.com/spf13/cobra"
+)
+
+var webCmd = &cobra.Command{
+	Use:   "web",
+	Short: "Helpers for the web endpoints of serve",
+}
+
+var hashPasswordCmd = &cobra.Command{
+	Use:   "hash-password",
+	Short: "Read a password from stdin and print its bcrypt hash for web.password_hash",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return fmt.Errorf("password must not be empty")
+		}
+
+		hash, err := web.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		fmt.Println(hash)
+		return nil
+	},
+}
+
+func init() {
+	webCmd.AddCommand(hashPasswordCmd)
+}
@@ -0,0 +1,77 @@
+// Package metrics holds the Prometheus collectors shared by the serve loop and the web server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all mail-reflector collectors; it is served on the web server's /metrics route
+var Registry = prometheus.NewRegistry()
+
+var (
+	// MessagesFetched counts messages whose body was fetched from the IMAP server
+	MessagesFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mail_reflector_messages_fetched_total",
+		Help: "Messages fetched from the IMAP server.",
+	})
+	// MessagesMatched counts fetched messages that matched the filters
+	MessagesMatched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mail_reflector_messages_matched_total",
+		Help: "Fetched messages that matched the filters.",
+	})
+	// MessagesForwarded counts messages forwarded to the recipients
+	MessagesForwarded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mail_reflector_messages_forwarded_total",
+		Help: "Messages forwarded to the recipients.",
+	})
+	// MessagesFailed counts messages that could not be fetched or forwarded
+	MessagesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mail_reflector_messages_failed_total",
+		Help: "Messages that could not be fetched or forwarded.",
+	})
+	// MessagesSkippedProblematic counts messages skipped after failing repeatedly
+	MessagesSkippedProblematic = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mail_reflector_messages_skipped_problematic_total",
+		Help: "Messages skipped because they failed repeatedly.",
+	})
+	// IMAPConnected is 1 while the serve loop holds a working IMAP connection
+	IMAPConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mail_reflector_imap_connected",
+		Help: "Whether the serve loop is connected to the IMAP server (1) or not (0).",
+	})
+	// IMAPConnectAlert is 1 while connecting has failed `serve.alert_after_failures` times in a row
+	IMAPConnectAlert = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mail_reflector_imap_connect_alert",
+		Help: "Whether connecting to the IMAP server has failed repeatedly (1) or not (0).",
+	})
+	// ForwardDuration observes how long sending a single forward takes
+	ForwardDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mail_reflector_forward_duration_seconds",
+		Help:    "Time taken to forward a single message, including saving it to Sent.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		MessagesFetched,
+		MessagesMatched,
+		MessagesForwarded,
+		MessagesFailed,
+		MessagesSkippedProblematic,
+		IMAPConnected,
+		IMAPConnectAlert,
+		ForwardDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
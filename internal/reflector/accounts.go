@@ -0,0 +1,220 @@
+package reflector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// accountEnv names the account a `serve` child process of a multi-account setup works on
+const accountEnv = "MAIL_REFLECTOR_ACCOUNT"
+
+const (
+	// accountRestartDelay is the initial delay before restarting an account that stopped
+	accountRestartDelay = 10 * time.Second
+	// accountMaxRestartDelay caps the exponential backoff between restarts
+	accountMaxRestartDelay = 5 * time.Minute
+	// accountStopTimeout is how long an account gets to shut down before it is killed
+	accountStopTimeout = 30 * time.Second
+)
+
+// selectedAccount is the account this process works on ("" without `accounts`)
+var (
+	selectedAccount string
+	accountMu       sync.Mutex
+)
+
+// accountConfigs returns the entries of the `accounts` list keyed by their unique name
+func accountConfigs() ([]string, map[string]map[string]any, error) {
+	raw, ok := viper.Get("accounts").([]any)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	var names []string
+	configs := make(map[string]map[string]any)
+	for i, entry := range raw {
+		account, ok := entry.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("accounts[%d] is not a mapping", i)
+		}
+		name, _ := account["name"].(string)
+		if name == "" {
+			return nil, nil, fmt.Errorf("accounts[%d] has no name", i)
+		}
+		if _, dup := configs[name]; dup {
+			return nil, nil, fmt.Errorf("account name %q is used more than once", name)
+		}
+		names = append(names, name)
+		configs[name] = account
+	}
+	return names, configs, nil
+}
+
+// HasAccounts reports whether this process should supervise the accounts configured in
+// `accounts` rather than serve a mailbox itself
+func HasAccounts() bool {
+	if os.Getenv(accountEnv) != "" {
+		return false
+	}
+	names, _, err := accountConfigs()
+	return err != nil || len(names) > 0
+}
+
+// IsAccountProcess reports whether this process is the child process serving one account of
+// a multi-account `serve`
+func IsAccountProcess() bool {
+	return os.Getenv(accountEnv) != ""
+}
+
+// ValidateAccounts checks the `accounts` list: names must be unique, and no two accounts may
+// share a `state.file`, as their processes would overwrite each other's records
+func ValidateAccounts() []error {
+	names, configs, err := accountConfigs()
+	if err != nil {
+		return []error{fmt.Errorf("invalid accounts: %w", err)}
+	}
+
+	var errs []error
+	owners := make(map[string]string)
+	for _, name := range names {
+		path := accountStateFile(configs[name])
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if other, dup := owners[path]; dup {
+			errs = append(errs, fmt.Errorf("accounts %q and %q share state.file %s; give each account its own", other, name, path))
+			continue
+		}
+		owners[path] = name
+	}
+	return errs
+}
+
+// accountStateFile returns the `state.file` an account uses: its own, or the shared default
+func accountStateFile(account map[string]any) string {
+	if state, ok := account["state"].(map[string]any); ok {
+		if path, ok := state["file"].(string); ok && path != "" {
+			return path
+		}
+	}
+	return viper.GetString("state.file")
+}
+
+// SelectAccountFromEnv applies the account named in the environment on top of the top-level
+// config, so a child process of ServeAccounts sees it as a plain single-account config
+func SelectAccountFromEnv() error {
+	name := os.Getenv(accountEnv)
+	if name == "" {
+		return nil
+	}
+
+	accountMu.Lock()
+	selectedAccount = name
+	accountMu.Unlock()
+	return applySelectedAccount()
+}
+
+// applySelectedAccount merges the selected account's settings over the top-level config. It
+// has to run again after every config reload, which discards the merged settings.
+func applySelectedAccount() error {
+	accountMu.Lock()
+	name := selectedAccount
+	accountMu.Unlock()
+	if name == "" {
+		return nil
+	}
+
+	_, configs, err := accountConfigs()
+	if err != nil {
+		return err
+	}
+	account, ok := configs[name]
+	if !ok {
+		return fmt.Errorf("account %q not found in accounts", name)
+	}
+
+	if err := viper.MergeConfigMap(account); err != nil {
+		return fmt.Errorf("failed to apply account %q: %w", name, err)
+	}
+	// Tell the accounts apart in the shared log output
+	if !viper.IsSet("log.labels.account") {
+		viper.Set("log.labels.account", name)
+	}
+	return nil
+}
+
+// ServeAccounts serves every account configured in `accounts`, each in its own `serve` child
+// process, so connections, caches and failure tracking of one account can't affect another.
+// Settings outside `accounts` are shared defaults each account can override. Accounts that stop
+// unexpectedly are restarted with backoff; all of them are stopped when ctx is cancelled.
+func ServeAccounts(ctx context.Context) error {
+	if errs := ValidateAccounts(); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	names, _, err := accountConfigs()
+	if err != nil {
+		return fmt.Errorf("invalid accounts: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	slog.Info("Serving multiple accounts", "accounts", names)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			superviseAccount(ctx, exe, name)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// superviseAccount runs the child process serving one account until ctx is cancelled
+func superviseAccount(ctx context.Context, exe, name string) {
+	delay := accountRestartDelay
+	for {
+		cmd := exec.CommandContext(ctx, exe, os.Args[1:]...)
+		cmd.Env = append(os.Environ(), accountEnv+"="+name)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		// Let the account shut down gracefully like on Ctrl-C
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = accountStopTimeout
+
+		slog.Info("Starting account", "account", name)
+		started := time.Now()
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			slog.Info("Account stopped", "account", name)
+			return
+		}
+
+		// An account that ran for a while failed for a new reason, start over with the backoff
+		if time.Since(started) > accountMaxRestartDelay {
+			delay = accountRestartDelay
+		}
+		slog.Error("Account stopped unexpectedly, restarting", "account", name, "error", err, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, accountMaxRestartDelay)
+	}
+}
@@ -0,0 +1,110 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const accountsConfig = `
+imap:
+  server: imap.example.org
+  port: 993
+recipients: [team@example.org]
+accounts:
+  - name: first
+    imap:
+      username: first@example.org
+  - name: second
+    imap:
+      server: imap.example.com
+      username: second@example.com
+    recipients: [other@example.com]
+`
+
+func TestSelectAccount(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { selectedAccount = "" })
+
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(accountsConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if !HasAccounts() {
+		t.Fatal("expected the accounts to be detected")
+	}
+
+	t.Setenv(accountEnv, "second")
+	if HasAccounts() {
+		t.Error("an account's child process must not supervise accounts itself")
+	}
+	if err := SelectAccountFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := viper.GetString("imap.server"); got != "imap.example.com" {
+		t.Errorf("imap.server = %q, want the account's server", got)
+	}
+	if got := viper.GetInt("imap.port"); got != 993 {
+		t.Errorf("imap.port = %d, want the shared default", got)
+	}
+	if got := viper.GetStringSlice("recipients"); len(got) != 1 || got[0] != "other@example.com" {
+		t.Errorf("recipients = %v, want the account's recipients", got)
+	}
+	if got := viper.GetString("log.labels.account"); got != "second" {
+		t.Errorf("log.labels.account = %q", got)
+	}
+
+	t.Setenv(accountEnv, "third")
+	if err := SelectAccountFromEnv(); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+}
+
+func TestAccountConfigsValidation(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("accounts", []any{map[string]any{"name": "a"}, map[string]any{"name": "a"}})
+	if _, _, err := accountConfigs(); err == nil {
+		t.Error("expected an error for duplicate account names")
+	}
+
+	viper.Set("accounts", []any{map[string]any{"imap": map[string]any{}}})
+	if _, _, err := accountConfigs(); err == nil {
+		t.Error("expected an error for an account without name")
+	}
+}
+
+func TestValidateAccountsStateFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	account := func(name, stateFile string) map[string]any {
+		a := map[string]any{"name": name}
+		if stateFile != "" {
+			a["state"] = map[string]any{"file": stateFile}
+		}
+		return a
+	}
+
+	viper.Set("accounts", []any{account("a", "state-a.json"), account("b", "state-b.json")})
+	if errs := ValidateAccounts(); len(errs) != 0 {
+		t.Errorf("separate state files should be valid, got %v", errs)
+	}
+
+	viper.Set("accounts", []any{account("a", "state.json"), account("b", "./state.json")})
+	if errs := ValidateAccounts(); len(errs) != 1 {
+		t.Errorf("expected an error for a shared state file, got %v", errs)
+	}
+
+	// Accounts without their own state file inherit the shared one
+	viper.Set("state.file", "state.json")
+	viper.Set("accounts", []any{account("a", ""), account("b", "")})
+	if errs := ValidateAccounts(); len(errs) != 1 {
+		t.Errorf("expected an error for accounts inheriting the same state file, got %v", errs)
+	}
+	viper.Set("accounts", []any{account("a", ""), account("b", "state-b.json")})
+	if errs := ValidateAccounts(); len(errs) != 0 {
+		t.Errorf("one account may use the shared state file, got %v", errs)
+	}
+}
@@ -0,0 +1,172 @@
+package reflector
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// autoconfigTimeout bounds each autoconfig lookup request
+const autoconfigTimeout = 10 * time.Second
+
+// ServerSettings are the connection settings of an IMAP or SMTP server
+type ServerSettings struct {
+	Server   string
+	Port     int
+	Security string // ssl, starttls or none, as used in the config
+	Username string
+}
+
+// Autoconfig holds the server settings published for a mail domain
+type Autoconfig struct {
+	IMAP ServerSettings
+	SMTP ServerSettings
+}
+
+// autoconfigURLs returns the locations Mozilla-style autoconfig is looked up at, in order: the
+// provider's own autoconfig host, its well-known URL and Thunderbird's central database
+var autoconfigURLs = func(domain, email string) []string {
+	return []string{
+		"https://autoconfig." + domain + "/mail/config-v1.1.xml?emailaddress=" + url.QueryEscape(email),
+		"https://" + domain + "/.well-known/autoconfig/mail/config-v1.1.xml",
+		"https://autoconfig.thunderbird.net/v1.1/" + domain,
+	}
+}
+
+// autoconfigServer is an incomingServer or outgoingServer element of the autoconfig XML
+type autoconfigServer struct {
+	Type       string `xml:"type,attr"`
+	Hostname   string `xml:"hostname"`
+	Port       int    `xml:"port"`
+	SocketType string `xml:"socketType"`
+	Username   string `xml:"username"`
+}
+
+// autoconfigDocument is the part of the clientConfig XML format needed here
+type autoconfigDocument struct {
+	Incoming []autoconfigServer `xml:"emailProvider>incomingServer"`
+	Outgoing []autoconfigServer `xml:"emailProvider>outgoingServer"`
+}
+
+// LookupAutoconfig fetches the IMAP and SMTP settings published for the domain of email,
+// trying each autoconfig location until one provides both
+func LookupAutoconfig(ctx context.Context, email string) (*Autoconfig, error) {
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return nil, fmt.Errorf("invalid email address %q", email)
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	var errs []error
+	for _, u := range autoconfigURLs(domain, email) {
+		config, err := fetchAutoconfig(ctx, u, email)
+		if err == nil {
+			slog.Debug("Found autoconfig", "url", u)
+			return config, nil
+		}
+		slog.Debug("Autoconfig lookup failed", "url", u, "error", err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no autoconfig found for %s: %w", domain, errors.Join(errs...))
+}
+
+// fetchAutoconfig downloads and parses one autoconfig document
+func fetchAutoconfig(ctx context.Context, u, email string) (*Autoconfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, autoconfigTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	return parseAutoconfig(body, email)
+}
+
+// parseAutoconfig picks the first usable IMAP and SMTP server from an autoconfig document
+func parseAutoconfig(data []byte, email string) (*Autoconfig, error) {
+	var doc autoconfigDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid autoconfig document: %w", err)
+	}
+
+	imapServer, ok := firstAutoconfigServer(doc.Incoming, "imap", email)
+	if !ok {
+		return nil, errors.New("autoconfig lists no IMAP server")
+	}
+	smtpServer, ok := firstAutoconfigServer(doc.Outgoing, "smtp", email)
+	if !ok {
+		return nil, errors.New("autoconfig lists no SMTP server")
+	}
+	return &Autoconfig{IMAP: imapServer, SMTP: smtpServer}, nil
+}
+
+// firstAutoconfigServer returns the first complete server of the given type, with the username
+// placeholders expanded for email
+func firstAutoconfigServer(servers []autoconfigServer, typ, email string) (ServerSettings, bool) {
+	localPart, domain, _ := strings.Cut(email, "@")
+	placeholders := strings.NewReplacer(
+		"%EMAILADDRESS%", email,
+		"%EMAILLOCALPART%", localPart,
+		"%EMAILDOMAIN%", domain,
+	)
+
+	for _, s := range servers {
+		if s.Type != typ || s.Hostname == "" || s.Port <= 0 || s.Port > 65535 {
+			continue
+		}
+		security, ok := autoconfigSecurity(s.SocketType)
+		if !ok {
+			continue
+		}
+		return ServerSettings{
+			Server:   placeholders.Replace(s.Hostname),
+			Port:     s.Port,
+			Security: security,
+			Username: placeholders.Replace(s.Username),
+		}, true
+	}
+	return ServerSettings{}, false
+}
+
+// autoconfigSecurity maps an autoconfig socketType to the config's security value
+func autoconfigSecurity(socketType string) (string, bool) {
+	switch strings.ToUpper(socketType) {
+	case "SSL":
+		return "ssl", true
+	case "STARTTLS":
+		return "starttls", true
+	case "PLAIN":
+		return "none", true
+	default:
+		return "", false
+	}
+}
+
+// PortString returns the port for display and config output, or "" if unknown
+func (s ServerSettings) PortString() string {
+	if s.Port == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.Port)
+}
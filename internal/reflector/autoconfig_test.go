@@ -0,0 +1,68 @@
+package reflector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAutoconfig = `<?xml version="1.0" encoding="UTF-8"?>
+<clientConfig version="1.1">
+  <emailProvider id="example.org">
+    <incomingServer type="pop3">
+      <hostname>pop.example.org</hostname>
+      <port>995</port>
+      <socketType>SSL</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.example.org</hostname>
+      <port>993</port>
+      <socketType>SSL</socketType>
+      <username>%EMAILADDRESS%</username>
+    </incomingServer>
+    <outgoingServer type="smtp">
+      <hostname>smtp.example.org</hostname>
+      <port>587</port>
+      <socketType>STARTTLS</socketType>
+      <username>%EMAILLOCALPART%</username>
+    </outgoingServer>
+  </emailProvider>
+</clientConfig>`
+
+func TestLookupAutoconfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/found" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testAutoconfig))
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := autoconfigURLs
+	t.Cleanup(func() { autoconfigURLs = orig })
+	autoconfigURLs = func(domain, email string) []string {
+		return []string{srv.URL + "/missing", srv.URL + "/found"}
+	}
+
+	config, err := LookupAutoconfig(context.Background(), "jane@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Autoconfig{
+		IMAP: ServerSettings{Server: "imap.example.org", Port: 993, Security: "ssl", Username: "jane@example.org"},
+		SMTP: ServerSettings{Server: "smtp.example.org", Port: 587, Security: "starttls", Username: "jane"},
+	}
+	if *config != want {
+		t.Errorf("LookupAutoconfig = %+v, want %+v", *config, want)
+	}
+
+	autoconfigURLs = func(domain, email string) []string { return []string{srv.URL + "/missing"} }
+	if _, err := LookupAutoconfig(context.Background(), "jane@example.org"); err == nil {
+		t.Error("expected an error when no autoconfig is found")
+	}
+	if _, err := LookupAutoconfig(context.Background(), "not-an-address"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
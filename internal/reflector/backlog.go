@@ -0,0 +1,105 @@
+package reflector
+
+import (
+	"log/slog"
+	"slices"
+	"sort"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// Backlog policies controlling what happens to matching mail that already exists
+// when the reflector starts (serve) or runs (check)
+const (
+	backlogForwardAll      = "forward_all"
+	backlogForwardNewestN  = "forward_newest_n"
+	backlogSkipAllMarkSeen = "skip_all_mark_seen"
+	backlogIgnoreExisting  = "ignore_existing" // serve only: leave mail from before startup untouched
+)
+
+// applyBacklogPolicy splits a backlog of matching mails into those to forward and those
+// to only mark as seen, according to `processing.backlog_policy` and `processing.backlog_n`.
+func applyBacklogPolicy(mails []MailSummary) (forward, skip []MailSummary) {
+	policy := viper.GetString("processing.backlog_policy")
+
+	switch policy {
+	case "", backlogForwardAll, backlogIgnoreExisting:
+		// With ignore_existing, serve already filtered out mail older than its startup baseline
+		return mails, nil
+	case backlogSkipAllMarkSeen:
+		slog.Info("Backlog policy: marking all existing matching mails as seen without forwarding", "count", len(mails))
+		return nil, mails
+	case backlogForwardNewestN:
+		n := viper.GetInt("processing.backlog_n")
+		if n < 0 {
+			n = 0
+		}
+
+		// Order newest first by the server's internal (arrival) date
+		sorted := make([]MailSummary, len(mails))
+		copy(sorted, mails)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].InternalDate.After(sorted[j].InternalDate)
+		})
+
+		if n >= len(sorted) {
+			return mails, nil
+		}
+
+		slog.Info("Backlog policy: forwarding only the newest messages", "forward", n, "mark_seen_only", len(sorted)-n)
+
+		// Forward the kept messages in chronological order
+		forward = sorted[:n]
+		slices.Reverse(forward)
+		return forward, sorted[n:]
+	default:
+		slog.Warn("Unknown processing.backlog_policy, forwarding all", "policy", policy)
+		return mails, nil
+	}
+}
+
+// uidBaseline remembers the highest INBOX UID at serve startup for the ignore_existing policy.
+// UIDs only grow within a UIDVALIDITY, so anything above it arrived after startup, independent
+// of the \Seen flags and of IDLE updates that don't carry arrival times.
+type uidBaseline struct {
+	uid      uint32
+	validity uint32
+}
+
+// apply captures the baseline on the first connection and hands it to imapConn. If the server
+// changed UIDVALIDITY in between, the old UIDs are meaningless and the baseline is taken anew.
+func (b *uidBaseline) apply(imapConn *imapConn) {
+	if viper.GetString("processing.backlog_policy") != backlogIgnoreExisting {
+		return
+	}
+
+	status := getCurrentMailboxStatus()
+	if status == nil || status.UidNext == 0 {
+		slog.Warn("Server did not report UIDNEXT, cannot ignore existing mail by UID")
+		return
+	}
+
+	switch {
+	case b.validity == 0:
+		b.uid, b.validity = status.UidNext-1, status.UidValidity
+		slog.Info("Ignoring mail that existed before startup", "baseline_uid", b.uid)
+	case b.validity != status.UidValidity:
+		b.uid, b.validity = status.UidNext-1, status.UidValidity
+		slog.Warn("UIDVALIDITY changed, taking a new startup baseline; mail received while disconnected may be ignored",
+			"baseline_uid", b.uid)
+	}
+
+	imapConn.baselineUID = b.uid
+}
+
+// skipBacklogMessage marks a mail skipped by the backlog policy as seen and records it in
+// the state store, so later reconciliation passes don't mistake it for missed mail
+func skipBacklogMessage(c *client.Client, mail MailSummary) error {
+	if store := getStateStore(); store != nil && mail.Envelope != nil && mail.Envelope.MessageId != "" {
+		if err := store.setForwardStatus(mail.Envelope.MessageId, mail.Envelope.Subject, forwardStatusSkipped); err != nil {
+			slog.Warn("Could not record skipped mail in state file", "uid", mail.UID, "error", err)
+		}
+	}
+	return markAsSeen(c, mail.UID)
+}
@@ -0,0 +1,78 @@
+package reflector
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestApplyBacklogPolicy(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mails := []MailSummary{
+		{UID: 1, InternalDate: base.Add(1 * time.Hour)},
+		{UID: 2, InternalDate: base.Add(3 * time.Hour)},
+		{UID: 3, InternalDate: base.Add(2 * time.Hour)},
+	}
+
+	viper.Set("processing.backlog_policy", "forward_newest_n")
+	viper.Set("processing.backlog_n", 2)
+
+	forward, skip := applyBacklogPolicy(mails)
+	if len(forward) != 2 || forward[0].UID != 3 || forward[1].UID != 2 {
+		t.Errorf("expected UIDs 3, 2 to be forwarded in chronological order, got %+v", forward)
+	}
+	if len(skip) != 1 || skip[0].UID != 1 {
+		t.Errorf("expected UID 1 to be skipped, got %+v", skip)
+	}
+
+	viper.Set("processing.backlog_policy", "skip_all_mark_seen")
+	forward, skip = applyBacklogPolicy(mails)
+	if len(forward) != 0 || len(skip) != 3 {
+		t.Errorf("expected all mails skipped, got forward=%d skip=%d", len(forward), len(skip))
+	}
+
+	viper.Set("processing.backlog_policy", "forward_all")
+	forward, skip = applyBacklogPolicy(mails)
+	if len(forward) != 3 || len(skip) != 0 {
+		t.Errorf("expected all mails forwarded, got forward=%d skip=%d", len(forward), len(skip))
+	}
+}
+
+func TestUIDBaseline(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { setCurrentMailboxStatus(nil) })
+
+	viper.Set("processing.backlog_policy", "ignore_existing")
+	setCurrentMailboxStatus(&imap.MailboxStatus{UidNext: 7, UidValidity: 1})
+
+	baseline := &uidBaseline{}
+	conn := &imapConn{}
+	baseline.apply(conn)
+	if conn.baselineUID != 6 {
+		t.Fatalf("expected baseline UID 6, got %d", conn.baselineUID)
+	}
+	if got := conn.aboveBaseline([]uint32{3, 6, 7, 9}); !slices.Equal(got, []uint32{7, 9}) {
+		t.Errorf("expected only UIDs above the baseline, got %v", got)
+	}
+
+	// A reconnect keeps the baseline taken at startup
+	setCurrentMailboxStatus(&imap.MailboxStatus{UidNext: 12, UidValidity: 1})
+	conn = &imapConn{}
+	baseline.apply(conn)
+	if conn.baselineUID != 6 {
+		t.Errorf("expected baseline UID 6 after reconnect, got %d", conn.baselineUID)
+	}
+
+	// A new UIDVALIDITY invalidates it
+	setCurrentMailboxStatus(&imap.MailboxStatus{UidNext: 3, UidValidity: 2})
+	conn = &imapConn{}
+	baseline.apply(conn)
+	if conn.baselineUID != 2 {
+		t.Errorf("expected new baseline UID 2, got %d", conn.baselineUID)
+	}
+}
@@ -1,8 +1,10 @@
 package reflector
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/spf13/viper"
 )
@@ -11,33 +13,120 @@ import (
 func CheckAndForward() error {
 	fmt.Println("Connecting to IMAP...")
 
-	mails, client, err := FetchMatchingMails()
+	result, err := CheckAndForwardResult(context.Background())
 	if err != nil {
 		return err
 	}
 
+	fmt.Println(result)
+
+	// With summaries enabled, each run reports its counts
+	if summaryInterval() > 0 {
+		sendSummary()
+	}
+	return nil
+}
+
+// CheckAndForwardResult runs a single check like CheckAndForward and reports the outcome for each
+// matching message instead of printing it. Processing stops early when ctx is cancelled; the
+// messages handled up to then are still reported.
+func CheckAndForwardResult(ctx context.Context) (*CheckResult, error) {
+	warnIfRedirecting()
+
+	mails, pending, client, err := FetchMatchingMails()
+	if err != nil {
+		return nil, err
+	}
+
 	defer func() {
-		_ = client.Logout()
+		// Give forward hooks and notifications a chance to complete before the process exits
+		waitForHooks()
+		waitForNotifications()
+
+		if client != nil {
+			_ = client.Logout()
+			slog.Info("Logged out from IMAP server")
+		}
 	}()
 
+	result := &CheckResult{Matched: len(mails)}
+
+	// Everything up to the newest message at search time is covered by this run
+	hwmStore, searchStatus := highWaterMarkStore(), getCurrentMailboxStatus()
+
 	if len(mails) == 0 {
-		fmt.Println("No matching mails to forward.")
-		return nil
+		advanceHighWaterMark(hwmStore, searchStatus, nil, pending)
+		return result, nil
 	}
 
-	for _, mail := range mails {
+	if !forwardingEnabled() {
+		slog.Warn("Forwarding is paused, leaving messages unseen", "count", len(mails))
+		result.Paused = true
+		return result, nil
+	}
+
+	// The search ran read-only, marking as seen needs a read-write selection
+	if searchReadOnly() {
+		if _, err := client.Select(sourceMailbox, false); err != nil {
+			return result, fmt.Errorf("failed to select INBOX read-write: %w", err)
+		}
+	}
+
+	mails, skipped := applyBacklogPolicy(mails)
+	for _, mail := range skipped {
+		msg := newMessageResult(mail)
+		msg.Status, msg.Reason = MessageSkipped, "backlog policy"
+		if err := skipBacklogMessage(client, mail); err != nil {
+			slog.Warn("Could not mark skipped backlog mail as seen", "uid", mail.UID, "error", err)
+			msg.Reason += ", could not mark as seen: " + err.Error()
+		}
+		result.add(msg)
+	}
+
+	batch := newSeenBatch()
+	// Messages that couldn't be fetched are searched for again by the next run
+	failed := slices.Clone(pending)
+	for i, mail := range mails {
+		if i > 0 && !waitInterMessageDelay(ctx) || ctx.Err() != nil {
+			slog.Warn("Check cancelled, leaving remaining mails for the next run", "remaining", len(mails)-i)
+			// Unprocessed mails must not be covered by the high-water mark
+			for _, m := range mails[i:] {
+				failed = append(failed, m.UID)
+			}
+			break
+		}
+
 		recipients := viper.GetStringSlice("recipients")
 		slog.Info("Forwarding mail", "subject", mail.Envelope.Subject, "uid", mail.UID, "recipients", recipients, "recipient_count", len(recipients))
 
-		if err := ForwardMail(client, mail); err != nil {
+		msg, err := forwardMessageWithResult(ctx, client, mail, batch, nil)
+		if err != nil {
 			slog.Error("Failed to forward", "uid", mail.UID, "error", err)
-			continue
+			failed = append(failed, mail.UID)
+			if msg.Status == "" {
+				msg.Status, msg.Reason = MessageFailed, err.Error()
+			} else if msg.Reason == "" {
+				msg.Reason = err.Error()
+			}
 		}
+		result.add(msg)
 
-		if err := markAsSeen(client, mail.UID); err != nil {
-			slog.Warn("Could not mark mail as seen", "uid", mail.UID, "error", err)
+		// Continue on a fresh connection if the server closed this one (e.g. during APPEND)
+		if isConnectionClosed(client) {
+			slog.Warn("IMAP connection was closed, reconnecting")
+			fresh, err := connectAndLogin()
+			if err != nil {
+				return result, fmt.Errorf("failed to reconnect to IMAP server: %w", err)
+			}
+			client = fresh
 		}
 	}
 
-	return nil
+	if err := batch.flush(client); err != nil {
+		slog.Error("Failed to mark forwarded mails as seen", "error", err)
+	}
+
+	advanceHighWaterMark(hwmStore, searchStatus, mails, failed)
+
+	return result, nil
 }
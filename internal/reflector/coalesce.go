@@ -0,0 +1,54 @@
+package reflector
+
+import "sync"
+
+// defaultUpdatesBuffer is the default capacity of the IDLE updates channel (`serve.updates_buffer`)
+const defaultUpdatesBuffer = 64
+
+// updateCoalescer serializes processing runs triggered by IDLE updates. A trigger arriving
+// while a run is in progress isn't dropped: any number of them is coalesced into exactly one
+// more run right after the current one, so mail arriving during a slow forward is still
+// picked up without the update reader ever blocking.
+type updateCoalescer struct {
+	mu      sync.Mutex
+	running bool
+	pending bool
+}
+
+// trigger requests a run. It returns true if the caller should start one; otherwise a run is
+// in progress and will be followed by another.
+func (u *updateCoalescer) trigger() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.running {
+		u.pending = true
+		return false
+	}
+	u.running = true
+	return true
+}
+
+// tryStart claims the worker without queueing a run if it is busy, e.g. to recycle the
+// connection in between runs
+func (u *updateCoalescer) tryStart() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.running {
+		return false
+	}
+	u.running = true
+	return true
+}
+
+// finish is called at the end of a run. It returns true if triggers arrived during the run and
+// the caller should run again; otherwise the worker is released.
+func (u *updateCoalescer) finish() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.pending {
+		u.pending = false
+		return true
+	}
+	u.running = false
+	return false
+}
@@ -0,0 +1,33 @@
+package reflector
+
+import "testing"
+
+func TestUpdateCoalescer(t *testing.T) {
+	t.Parallel()
+
+	var u updateCoalescer
+	if !u.trigger() {
+		t.Fatal("first trigger should start a run")
+	}
+	if u.trigger() || u.trigger() {
+		t.Fatal("triggers during a run should not start another worker")
+	}
+	if u.tryStart() {
+		t.Fatal("tryStart should fail while a run is in progress")
+	}
+	if !u.finish() {
+		t.Fatal("triggers during the run should cause exactly one more run")
+	}
+	if u.finish() {
+		t.Fatal("no further run expected")
+	}
+	if !u.tryStart() {
+		t.Fatal("tryStart should succeed once the worker is idle")
+	}
+	if u.finish() {
+		t.Fatal("tryStart should not queue a run")
+	}
+	if !u.trigger() {
+		t.Fatal("trigger should start a run once the worker is idle again")
+	}
+}
@@ -0,0 +1,117 @@
+package reflector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Confirmation modes deciding when a forwarded message may be marked as seen
+const (
+	confirmImmediate = "immediate" // right after the SMTP server accepted the forward (default)
+	confirmWebhook   = "webhook"   // after a downstream system acknowledged it via HTTP
+)
+
+// What happens when a confirmation fails or times out
+const (
+	confirmFailureMark  = "mark"  // mark as seen anyway (default)
+	confirmFailureRetry = "retry" // leave unseen, so confirmation is retried on the next run
+)
+
+// defaultConfirmTimeout limits how long to wait for a downstream acknowledgement
+const defaultConfirmTimeout = 30 * time.Second
+
+// deliveryConfirmer confirms that a forwarded message was accepted downstream
+type deliveryConfirmer interface {
+	Confirm(ctx context.Context, mail MailSummary) error
+}
+
+// immediateConfirmer treats every forward accepted by the SMTP server as confirmed
+type immediateConfirmer struct{}
+
+func (immediateConfirmer) Confirm(context.Context, MailSummary) error { return nil }
+
+// webhookConfirmer posts the forwarded message's metadata to a URL; a 2xx response is the ack,
+// any other response is a rejection
+type webhookConfirmer struct {
+	url    string
+	client *http.Client
+}
+
+// confirmPayload is the JSON body sent to the confirmation webhook
+type confirmPayload struct {
+	UID       uint32 `json:"uid"`
+	MessageID string `json:"message_id"`
+	From      string `json:"from"`
+	Subject   string `json:"subject"`
+}
+
+func (w webhookConfirmer) Confirm(ctx context.Context, mail MailSummary) error {
+	payload := confirmPayload{UID: mail.UID, From: getFromAddress(mail.Envelope)}
+	if mail.Envelope != nil {
+		payload.MessageID = mail.Envelope.MessageId
+		payload.Subject = mail.Envelope.Subject
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode confirmation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create confirmation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("confirmation request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("downstream rejected the message: %s", resp.Status)
+	}
+	return nil
+}
+
+// newDeliveryConfirmer returns the confirmer configured by `confirm.mode`
+func newDeliveryConfirmer() deliveryConfirmer {
+	if viper.GetString("confirm.mode") != confirmWebhook {
+		return immediateConfirmer{}
+	}
+	return webhookConfirmer{url: viper.GetString("confirm.webhook_url"), client: &http.Client{}}
+}
+
+// confirmDelivery waits for the downstream confirmation of a forwarded message. It returns an
+// error only if the message must stay unseen (`confirm.on_failure: retry`); otherwise failures
+// are logged and the message is marked as seen anyway.
+func confirmDelivery(mail MailSummary) error {
+	timeout := defaultConfirmTimeout
+	if viper.IsSet("confirm.timeout") {
+		timeout = viper.GetDuration("confirm.timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := newDeliveryConfirmer().Confirm(ctx, mail)
+	if err == nil {
+		return nil
+	}
+
+	if viper.GetString("confirm.on_failure") == confirmFailureRetry {
+		slog.Warn("Forward not confirmed downstream, leaving message unseen to retry", "uid", mail.UID, "error", err)
+		return fmt.Errorf("forward not confirmed: %w", err)
+	}
+
+	slog.Warn("Forward not confirmed downstream, marking as seen anyway", "uid", mail.UID, "error", err)
+	return nil
+}
@@ -0,0 +1,65 @@
+package reflector
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// defaultSettleDelay is the default time between the size reads of `fetch.confirm_complete`
+const defaultSettleDelay = 2 * time.Second
+
+// confirmCompleteRounds limits how often the size is re-read while it keeps changing
+const confirmCompleteRounds = 3
+
+// errStillDelivering is returned for messages whose size is still changing; they are left
+// unseen and picked up again by the next run
+var errStillDelivering = errors.New("message is still being delivered")
+
+// settleDelay returns the configured `fetch.settle_delay`
+func settleDelay() time.Duration {
+	if viper.IsSet("fetch.settle_delay") {
+		return max(viper.GetDuration("fetch.settle_delay"), 0)
+	}
+	return defaultSettleDelay
+}
+
+// confirmComplete guards against fetching a message the server is still receiving, which
+// some busy servers already report to IDLE and SEARCH: with `fetch.confirm_complete` it reads
+// the server-reported size twice, `fetch.settle_delay` apart, and only returns once both reads
+// agree. Messages not matching the filters are not waited for. It returns errStillDelivering
+// if the size is still changing after a few rounds.
+func confirmComplete(client *client.Client, uid uint32, filters []string, matched bool) error {
+	if !viper.GetBool("fetch.confirm_complete") {
+		return nil
+	}
+
+	msg, err := fetchMessageMeta(client, uid)
+	if err != nil {
+		return err
+	}
+	if !matched && !isMessageMatching(msg.Envelope, filters) {
+		return nil
+	}
+
+	size := msg.Size
+	for range confirmCompleteRounds {
+		time.Sleep(settleDelay())
+
+		msg, err := fetchMessageMeta(client, uid)
+		if err != nil {
+			return err
+		}
+		if msg.Size == size {
+			return nil
+		}
+		slog.Debug("Message size changed, waiting for delivery to finish", "uid", uid, "size", msg.Size, "previous_size", size)
+		size = msg.Size
+	}
+
+	return fmt.Errorf("%w (uid %d, size still changing after %d reads)", errStillDelivering, uid, confirmCompleteRounds+1)
+}
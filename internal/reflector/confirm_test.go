@@ -0,0 +1,78 @@
+package reflector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestConfirmDelivery(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	// A timed-out request's handler may still be running during the next one
+	var mu sync.Mutex
+	status := http.StatusOK
+	var got confirmPayload
+	setStatus := func(s int) {
+		mu.Lock()
+		defer mu.Unlock()
+		status = s
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload confirmPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		got = payload
+		status := status
+		mu.Unlock()
+		if status == 0 {
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	mail := MailSummary{UID: 7, Envelope: &imap.Envelope{MessageId: "<1@example.com>", Subject: "Hi"}}
+
+	// Immediate mode confirms without contacting anyone
+	if err := confirmDelivery(mail); err != nil {
+		t.Fatalf("immediate mode should confirm, got %v", err)
+	}
+
+	viper.Set("confirm.mode", "webhook")
+	viper.Set("confirm.webhook_url", srv.URL)
+	viper.Set("confirm.timeout", "50ms")
+	viper.Set("confirm.on_failure", "retry")
+
+	if err := confirmDelivery(mail); err != nil {
+		t.Fatalf("2xx should confirm, got %v", err)
+	}
+	mu.Lock()
+	payload := got
+	mu.Unlock()
+	if payload.UID != 7 || payload.MessageID != "<1@example.com>" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+
+	setStatus(http.StatusUnprocessableEntity)
+	if err := confirmDelivery(mail); err == nil {
+		t.Error("rejection should leave the message unseen in retry mode")
+	}
+
+	setStatus(0) // no answer within the timeout
+	if err := confirmDelivery(mail); err == nil {
+		t.Error("timeout should leave the message unseen in retry mode")
+	}
+
+	viper.Set("confirm.on_failure", "mark")
+	if err := confirmDelivery(mail); err != nil {
+		t.Errorf("failures should be ignored in mark mode, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// connSlotTimeout is how long a new connection waits for a free slot under `imap.max_connections`
+const connSlotTimeout = 2 * time.Minute
+
+// connSlots holds a semaphore per IMAP server host limiting concurrent connections
+var (
+	connSlots   = make(map[string]chan struct{})
+	connSlotsMu sync.Mutex
+)
+
+// acquireConnSlot reserves one of the `imap.max_connections` connection slots for host,
+// waiting for a free one if necessary. The returned release func frees the slot again.
+// Without a configured limit it returns immediately.
+func acquireConnSlot(host string) (release func(), err error) {
+	limit := viper.GetInt("imap.max_connections")
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	connSlotsMu.Lock()
+	slots, ok := connSlots[host]
+	if !ok || cap(slots) != limit {
+		slots = make(chan struct{}, limit)
+		connSlots[host] = slots
+	}
+	connSlotsMu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		slog.Info("IMAP connection limit reached, waiting for a free slot", "server", host, "max_connections", limit)
+		select {
+		case slots <- struct{}{}:
+		case <-time.After(connSlotTimeout):
+			return nil, fmt.Errorf("no free IMAP connection slot for %s after %v (imap.max_connections: %d)", host, connSlotTimeout, limit)
+		}
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
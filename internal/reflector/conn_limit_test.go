@@ -0,0 +1,50 @@
+package reflector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestAcquireConnSlot(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("imap.max_connections", 1)
+
+	release, err := acquireConnSlot("imap.test.example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		r, err := acquireConnSlot("imap.test.example")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		acquired <- r
+	}()
+
+	// Other hosts have their own slots
+	releaseOther, err := acquireConnSlot("imap.other.example")
+	if err != nil {
+		t.Fatalf("unexpected error for another host: %v", err)
+	}
+	releaseOther()
+
+	select {
+	case <-acquired:
+		t.Fatal("second connection must wait while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	release() // releasing twice must not free a second slot
+
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("waiting connection didn't get the freed slot")
+	}
+}
@@ -0,0 +1,103 @@
+package reflector
+
+import (
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+// ServiceCheck is the outcome of a connectivity test against one server
+type ServiceCheck struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Connectivity reports whether the configured IMAP and SMTP servers accept our credentials
+type Connectivity struct {
+	IMAP ServiceCheck `json:"imap"`
+	SMTP ServiceCheck `json:"smtp"`
+}
+
+// CheckConnectivity logs in to the IMAP and SMTP servers and reports the outcome. The IMAP
+// test doesn't select a mailbox, so it doesn't disturb the serve loop. Under
+// `imap.max_connections` it reports the serve loop's connection instead of opening another one.
+func CheckConnectivity() Connectivity {
+	return Connectivity{
+		IMAP: checkIMAPConnectivity(),
+		SMTP: checkSMTPConnectivity(),
+	}
+}
+
+// checkIMAPConnectivity tests the IMAP login
+func checkIMAPConnectivity() ServiceCheck {
+	if viper.GetInt("imap.max_connections") > 0 {
+		status := CurrentStatus()
+		if !status.LastConnectAttempt.IsZero() {
+			return ServiceCheck{OK: status.IMAPConnected, Error: status.LastConnectError, CheckedAt: status.LastConnectAttempt}
+		}
+	}
+
+	imapClient, err := dialAndAuthenticate()
+	if err != nil {
+		return newServiceCheck(err)
+	}
+	_ = imapClient.Logout()
+	return newServiceCheck(nil)
+}
+
+// checkSMTPConnectivity tests the SMTP connection and authentication
+func checkSMTPConnectivity() ServiceCheck {
+	s, err := newSMTPDialer().Dial()
+	if err != nil {
+		return newServiceCheck(err)
+	}
+	_ = s.Close()
+	return newServiceCheck(nil)
+}
+
+// newServiceCheck returns the check result for err, checked now
+func newServiceCheck(err error) ServiceCheck {
+	check := ServiceCheck{OK: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// LoginTest is the outcome of `mail-reflector test`
+type LoginTest struct {
+	IMAP     ServiceCheck
+	Messages uint32 // messages in the INBOX, if the IMAP login succeeded
+	Unseen   int    // unseen messages in the INBOX
+	SMTP     ServiceCheck
+}
+
+// OK reports whether both logins succeeded
+func (t LoginTest) OK() bool {
+	return t.IMAP.OK && t.SMTP.OK
+}
+
+// TestLogin logs in to the IMAP server and selects the INBOX, then connects and authenticates
+// to the SMTP server, to verify the configured credentials without waiting for mail
+func TestLogin() LoginTest {
+	var result LoginTest
+
+	imapClient, err := connectAndLogin()
+	result.IMAP = newServiceCheck(err)
+	if err == nil {
+		if mbox := imapClient.Mailbox(); mbox != nil {
+			result.Messages = mbox.Messages
+		}
+		criteria := imap.NewSearchCriteria()
+		criteria.WithoutFlags = []string{imap.SeenFlag}
+		if uids, err := uidSearchWithTimeout(imapClient, criteria, defaultIMAPTimeout); err == nil {
+			result.Unseen = len(uids)
+		}
+		_ = imapClient.Logout()
+	}
+
+	result.SMTP = checkSMTPConnectivity()
+	return result
+}
@@ -0,0 +1,57 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// handleFailedForward counts a failed forward in the state store. Once `forward.max_attempts`
+// is reached, the message is dead-lettered instead of being retried on every poll: it is copied
+// to `forward.dead_letter_folder` (if set) and marked as seen. It returns forwardErr while the
+// message should still be retried, and nil once it was given up on.
+func handleFailedForward(c *client.Client, store *stateStore, mail MailSummary, forwardErr error) error {
+	maxAttempts := viper.GetInt("forward.max_attempts")
+	if store == nil || maxAttempts <= 0 || mail.Envelope == nil || mail.Envelope.MessageId == "" {
+		return forwardErr
+	}
+	messageID := mail.Envelope.MessageId
+
+	attempts, err := store.recordFailedAttempt(messageID)
+	if err != nil {
+		slog.Warn("Could not record failed forward in state file", "uid", mail.UID, "error", err)
+	}
+	if attempts < maxAttempts {
+		slog.Warn("Forward failed, will retry", "uid", mail.UID, "attempt", attempts, "max_attempts", maxAttempts)
+		return forwardErr
+	}
+
+	if err := deadLetter(c, mail.UID); err != nil {
+		return fmt.Errorf("%w (giving up after %d attempts failed too: %v)", forwardErr, attempts, err)
+	}
+
+	if err := store.setForwardStatus(messageID, mail.Envelope.Subject, forwardStatusGivenUp); err != nil {
+		slog.Warn("Could not record dead-lettered mail in state file", "uid", mail.UID, "error", err)
+	}
+
+	slog.Error("Giving up on message after repeated forward failures",
+		"uid", mail.UID, "message_id", messageID, "subject", mail.Envelope.Subject,
+		"attempts", attempts, "folder", viper.GetString("forward.dead_letter_folder"), "last_error", forwardErr)
+	return nil
+}
+
+// deadLetter copies a message to `forward.dead_letter_folder`, if configured, and marks the
+// original as seen so it is no longer picked up. The original is never deleted.
+func deadLetter(c *client.Client, uid uint32) error {
+	if folder := viper.GetString("forward.dead_letter_folder"); folder != "" {
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uid)
+		if err := c.UidCopy(seqset, folder); err != nil {
+			return fmt.Errorf("failed to copy message to %s: %w", folder, err)
+		}
+	}
+	return markAsSeen(c, uid)
+}
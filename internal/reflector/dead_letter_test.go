@@ -0,0 +1,55 @@
+package reflector
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestHandleFailedForward(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	c := newTestIMAPClient(t)
+
+	store, err := loadStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	if err := c.Create("Dead Letter"); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+
+	viper.Set("forward.max_attempts", 2)
+	viper.Set("forward.dead_letter_folder", "Dead Letter")
+
+	mail := MailSummary{UID: 6, Envelope: &imap.Envelope{MessageId: "<a@example.org>", Subject: "Hi"}}
+	forwardErr := errors.New("smtp down")
+
+	if err := handleFailedForward(c, store, mail, forwardErr); !errors.Is(err, forwardErr) {
+		t.Fatalf("first failure should be retried, got %v", err)
+	}
+	if err := handleFailedForward(c, store, mail, forwardErr); err != nil {
+		t.Fatalf("second failure should dead-letter the message, got %v", err)
+	}
+	if got := store.forwardStatus("<a@example.org>"); got != forwardStatusGivenUp {
+		t.Errorf("unexpected status after giving up: %q", got)
+	}
+
+	status, err := c.Status("Dead Letter", []imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		t.Fatalf("failed to get folder status: %v", err)
+	}
+	if status.Messages != 1 {
+		t.Errorf("expected the message in the dead-letter folder, got %d messages", status.Messages)
+	}
+
+	uids, err := c.UidSearch(&imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(uids) != 0 {
+		t.Errorf("expected the original to be marked as seen, unseen: %v", uids)
+	}
+}
@@ -0,0 +1,82 @@
+package reflector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultDedupWindow is how long content hashes are remembered by default
+const defaultDedupWindow = 24 * time.Hour
+
+// contentDedupEnabled reports whether messages are deduplicated by content (`dedup.by_content_hash`)
+func contentDedupEnabled() bool {
+	return viper.GetBool("dedup.by_content_hash")
+}
+
+// dedupWindow returns the configured `dedup.window`
+func dedupWindow() time.Duration {
+	if viper.IsSet("dedup.window") {
+		return max(viper.GetDuration("dedup.window"), 0)
+	}
+	return defaultDedupWindow
+}
+
+// contentHash identifies a message by its sender, subject, body and attachments, so a resend
+// of the same content under a new Message-ID (e.g. a retry through another relay) hashes the
+// same. Case and whitespace are normalized, as relays and mailers may rewrap or re-encode the
+// text. Attachments count by name and data. Without a parsed body or attachments (encrypted
+// or empty messages), the raw message is hashed, or else the Message-ID, so such messages
+// aren't all taken for each other.
+func contentHash(mail MailSummary) string {
+	sender, subject, messageID := "", "", ""
+	if mail.Envelope != nil {
+		subject = mail.Envelope.Subject
+		messageID = mail.Envelope.MessageId
+		if len(mail.Envelope.From) > 0 {
+			sender = mail.Envelope.From[0].Address()
+		}
+	}
+	body := mail.TextBody
+	if strings.TrimSpace(body) == "" {
+		body = mail.HTMLBody
+	}
+
+	h := sha256.New()
+	for _, field := range []string{sender, subject, body} {
+		h.Write([]byte(normalizeForHash(field)))
+		h.Write([]byte{0})
+	}
+	for _, a := range mail.Attachments {
+		writePartHash(h, a.Filename, a.Data)
+	}
+	for _, img := range mail.InlineImages {
+		writePartHash(h, img.Filename, img.Data)
+	}
+
+	if strings.TrimSpace(body) == "" && len(mail.Attachments) == 0 && len(mail.InlineImages) == 0 {
+		if len(mail.Raw) > 0 {
+			h.Write(mail.Raw)
+		} else {
+			h.Write([]byte(messageID))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writePartHash adds an attachment's name and the hash of its data to h
+func writePartHash(h hash.Hash, filename string, data []byte) {
+	sum := sha256.Sum256(data)
+	h.Write([]byte(filename))
+	h.Write([]byte{0})
+	h.Write(sum[:])
+}
+
+// normalizeForHash lower-cases s and collapses all whitespace runs into single spaces
+func normalizeForHash(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
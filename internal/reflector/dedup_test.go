@@ -0,0 +1,94 @@
+package reflector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	mail := func(messageID, from, subject, body string) MailSummary {
+		sender := &imap.Address{MailboxName: from, HostName: "example.com"}
+		return MailSummary{
+			Envelope: &imap.Envelope{MessageId: messageID, Subject: subject, From: []*imap.Address{sender}},
+			TextBody: body,
+		}
+	}
+
+	original := mail("<1@relay-a>", "jane", "Meeting", "See you at 10.\r\n")
+	if contentHash(original) != contentHash(mail("<2@relay-b>", "JANE", "meeting ", "See  you\nat 10.")) {
+		t.Error("resends differing only in Message-ID, case and whitespace should hash the same")
+	}
+	if contentHash(original) == contentHash(mail("<3@relay-a>", "jane", "Meeting", "See you at 11.")) {
+		t.Error("different bodies should hash differently")
+	}
+	if contentHash(original) == contentHash(mail("<4@relay-a>", "bob", "Meeting", "See you at 10.")) {
+		t.Error("different senders should hash differently")
+	}
+
+	// Attachment-only mails, e.g. from a scanner, differ by their attachments
+	scan := func(filename, data string) MailSummary {
+		m := mail("<5@scanner>", "scanner", "Scan", "")
+		m.Attachments = []Attachment{{Filename: filename, ContentType: "application/pdf", Data: []byte(data)}}
+		return m
+	}
+	if contentHash(scan("scan.pdf", "%PDF-1 first")) == contentHash(scan("scan.pdf", "%PDF-1 second")) {
+		t.Error("attachments with different data should hash differently")
+	}
+	if contentHash(scan("scan.pdf", "%PDF-1 first")) == contentHash(scan("scan-2.pdf", "%PDF-1 first")) {
+		t.Error("attachments with different names should hash differently")
+	}
+	if contentHash(scan("scan.pdf", "%PDF-1 first")) != contentHash(scan("scan.pdf", "%PDF-1 first")) {
+		t.Error("identical attachments should hash the same")
+	}
+
+	// Without a parsed body, the raw message tells encrypted messages apart
+	encrypted := func(messageID, raw string) MailSummary {
+		m := mail(messageID, "jane", "Secret", "")
+		m.Encrypted, m.Raw = true, []byte(raw)
+		return m
+	}
+	if contentHash(encrypted("<6@a>", "-----BEGIN PGP MESSAGE----- one")) == contentHash(encrypted("<6@a>", "-----BEGIN PGP MESSAGE----- two")) {
+		t.Error("encrypted messages with different payloads should hash differently")
+	}
+	if contentHash(mail("<7@a>", "jane", "Empty", "")) == contentHash(mail("<8@a>", "jane", "Empty", "")) {
+		t.Error("empty messages should be told apart by their Message-ID")
+	}
+}
+
+func TestStateStore_ContentHashes(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to load empty state: %v", err)
+	}
+
+	if _, seen := store.contentSeen("abc", time.Hour); seen {
+		t.Error("unknown content should not be seen")
+	}
+	store.ContentHashes["old"] = time.Now().Add(-2 * time.Hour)
+	if _, seen := store.contentSeen("old", time.Hour); seen {
+		t.Error("content forwarded before the window should not count")
+	}
+
+	if err := store.recordContentHash("abc", time.Hour); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload state: %v", err)
+	}
+	if _, seen := reloaded.contentSeen("abc", time.Hour); !seen {
+		t.Error("recorded content should be seen after reloading")
+	}
+	if _, ok := reloaded.ContentHashes["old"]; ok {
+		t.Error("hashes older than the window should be pruned")
+	}
+}
@@ -0,0 +1,72 @@
+package reflector
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+)
+
+// What happens to PGP/MIME encrypted messages, whose bodies can't be recomposed
+// (`forward.encrypted_policy`)
+const (
+	encryptedPassthrough = "passthrough" // resend the original MIME structure unchanged (default)
+	encryptedSkip        = "skip"        // don't forward it, only mark it as seen
+	encryptedNotify      = "notify"      // like skip, but send a notification (see notify)
+)
+
+// encryptedPolicy returns the configured `forward.encrypted_policy`
+func encryptedPolicy() string {
+	switch policy := viper.GetString("forward.encrypted_policy"); policy {
+	case encryptedSkip, encryptedNotify:
+		return policy
+	default:
+		return encryptedPassthrough
+	}
+}
+
+// isEncrypted reports whether a message's header marks it as PGP/MIME (or other
+// multipart/encrypted) or S/MIME encrypted
+func isEncrypted(header message.Header) bool {
+	mediaType, params, _ := header.ContentType()
+	switch mediaType {
+	case "multipart/encrypted":
+		return true
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		// Opaque S/MIME signatures share the media type but aren't encrypted
+		return params["smime-type"] != "signed-data"
+	}
+	return false
+}
+
+// applyEncryptedPolicy applies `forward.encrypted_policy` to mail. It returns false if the
+// message must not be forwarded. Encrypted messages that are forwarded go out in pass-through
+// mode, so the encrypted payload arrives intact for recipients who can decrypt it.
+func applyEncryptedPolicy(mail MailSummary) bool {
+	if !mail.Encrypted {
+		return true
+	}
+
+	subject := ""
+	if mail.Envelope != nil {
+		subject = mail.Envelope.Subject
+	}
+
+	switch encryptedPolicy() {
+	case encryptedSkip:
+		slog.Info("Not forwarding encrypted message", "uid", mail.UID, "subject", subject)
+		return false
+	case encryptedNotify:
+		slog.Info("Not forwarding encrypted message, notifying", "uid", mail.UID, "subject", subject)
+		notify("encrypted_message", "A matching message is encrypted and was not forwarded.", map[string]string{
+			"uid":     strconv.FormatUint(uint64(mail.UID), 10),
+			"from":    getFromAddress(mail.Envelope),
+			"subject": subject,
+		})
+		return false
+	default:
+		slog.Info("Forwarding encrypted message unchanged", "uid", mail.UID, "subject", subject)
+		return true
+	}
+}
@@ -0,0 +1,113 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+)
+
+func TestEncryptedMessage(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	body := "--enc\r\n" +
+		"Content-Type: application/pgp-encrypted\r\n" +
+		"\r\n" +
+		"Version: 1\r\n" +
+		"--enc\r\n" +
+		"Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n" +
+		"\r\n" +
+		"-----BEGIN PGP MESSAGE-----\r\n" +
+		"hQEMA1234567890ABCDEF\r\n" +
+		"-----END PGP MESSAGE-----\r\n" +
+		"--enc--\r\n"
+	raw := "From: Jane <jane@example.com>\r\n" +
+		"Subject: Secret\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=enc\r\n" +
+		"\r\n" + body
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if !isEncrypted(entity.Header) {
+		t.Fatal("expected the message to be detected as encrypted")
+	}
+	for contentType, want := range map[string]bool{
+		"application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m": true,
+		"application/x-pkcs7-mime; name=smime.p7m":                          true,
+		"application/pkcs7-mime; smime-type=signed-data; name=smime.p7m":    false,
+		"multipart/signed; protocol=\"application/pgp-signature\"":          false,
+	} {
+		var h message.Header
+		h.Set("Content-Type", contentType)
+		if got := isEncrypted(h); got != want {
+			t.Errorf("isEncrypted(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+
+	mail := MailSummary{
+		Envelope:  &imap.Envelope{Subject: "Secret"},
+		Raw:       []byte(raw),
+		Encrypted: true,
+	}
+	if !applyEncryptedPolicy(mail) {
+		t.Error("expected encrypted messages to be forwarded by default")
+	}
+
+	// Forwarded in pass-through mode, the encrypted payload stays intact
+	out, err := buildPassthroughMessage(mail, "board@example.org", "<jane@example.com>", "<jane@example.com>", "Secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, gotBody, _ := strings.Cut(string(out), "\r\n\r\n"); gotBody != body {
+		t.Errorf("encrypted body was modified:\n%q", gotBody)
+	}
+
+	viper.Set("forward.encrypted_policy", "skip")
+	if applyEncryptedPolicy(mail) {
+		t.Error("expected encrypted messages to be skipped")
+	}
+	mail.Encrypted = false
+	if !applyEncryptedPolicy(mail) {
+		t.Error("expected the policy to only apply to encrypted messages")
+	}
+}
+
+func TestFetchEncryptedKeepsRaw(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	c := newTestIMAPClient(t)
+	filters := []string{"contact@example.org"}
+
+	raw := "From: contact@example.org\r\n" +
+		"Subject: Secret\r\n" +
+		"Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m\r\n" +
+		"\r\n" +
+		"MIAGCSqGSIb3DQEHA6CAMIACAQAxggE\r\n"
+	if err := c.Append("INBOX", nil, time.Now(), strings.NewReader(raw)); err != nil {
+		t.Fatalf("failed to append message: %v", err)
+	}
+
+	// Only the encrypted message is kept in full for pass-through
+	plain, _, err := fetchSingleMessage(c, 6, filters)
+	if err != nil {
+		t.Fatalf("failed to fetch plain message: %v", err)
+	}
+	if plain.Encrypted || plain.Raw != nil {
+		t.Errorf("expected no raw copy of a plain message, got encrypted=%v raw=%d bytes", plain.Encrypted, len(plain.Raw))
+	}
+	encrypted, _, err := fetchSingleMessage(c, 7, filters)
+	if err != nil {
+		t.Fatalf("failed to fetch encrypted message: %v", err)
+	}
+	if !encrypted.Encrypted || string(encrypted.Raw) != raw {
+		t.Errorf("expected the encrypted message in full, got encrypted=%v raw=%q", encrypted.Encrypted, encrypted.Raw)
+	}
+	if encrypted.Envelope == nil || encrypted.Envelope.Subject != "Secret" {
+		t.Errorf("expected the envelope to be kept, got %+v", encrypted.Envelope)
+	}
+}
@@ -1,41 +1,60 @@
 package reflector
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
 	"mime"
+	"net/textproto"
 	"strings"
 
 	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset" // decode non-UTF-8 bodies (e.g. ISO-8859-1, Windows-1252)
+	"github.com/spf13/viper"
 )
 
 // extractBodies parses a MIME message entity and extracts:
 // - text and HTML body (from multipart/alternative or single-part)
 // - attachments (from multipart/mixed or similar)
-func extractBodies(entity *message.Entity) (string, string, []Attachment) {
+// - inline images of HTML mails (parts with a Content-ID or an inline disposition)
+//
+// Part bodies are read through go-message's decoding readers, so quoted-printable and base64
+// transfer encodings are undone and text in other charsets is converted to UTF-8.
+func extractBodies(entity *message.Entity) (string, string, []Attachment, []InlineImage) {
 	var text, html string
 	var attachments []Attachment
-
-	// Get content type of the top-level entity (e.g. multipart/mixed)
-	mediaType, _, _ := entity.Header.ContentType()
-
-	// If it's multipart (e.g. mixed or alternative), walk through its parts
-	if strings.HasPrefix(mediaType, "multipart/") {
-		mr := entity.MultipartReader()
-
+	var inlineImages []InlineImage
+	concat := viper.GetBool("forward.concat_body_parts")
+	inlineTextAsBody := !viper.IsSet("forward.inline_text_as_body") || viper.GetBool("forward.inline_text_as_body")
+	usedNames := make(map[string]bool)
+	unnamed := 0
+
+	// walk collects bodies and attachments from the parts of a multipart entity, descending
+	// into nested multiparts (e.g. the multipart/alternative inside a multipart/mixed)
+	var walk func(mr message.MultipartReader)
+	walk = func(mr message.MultipartReader) {
 		for {
 			part, err := mr.NextPart()
 			if err == io.EOF {
 				break // done reading parts
 			}
 
-			if err != nil {
+			if isUnknownCharset(err) && part != nil {
+				// The part is still readable, its bytes are passed through unchanged
+				slog.Debug("Unknown charset in body part, keeping it unconverted", "error", err)
+			} else if err != nil {
 				break // skip faulty parts
 			}
 
 			// Get the content type and disposition of this part
-			partMediaType, _, _ := part.Header.ContentType()
-			disposition, _, _ := part.Header.ContentDisposition()
+			partMediaType, typeParams, _ := part.Header.ContentType()
+			if strings.HasPrefix(partMediaType, "multipart/") {
+				if nested := part.MultipartReader(); nested != nil {
+					walk(nested)
+				}
+				continue
+			}
+			disposition, dispositionParams, _ := part.Header.ContentDisposition()
 
 			// Read the body content
 			body, err := io.ReadAll(part.Body)
@@ -45,43 +64,88 @@ func extractBodies(entity *message.Entity) (string, string, []Attachment) {
 				continue
 			}
 
-			// Handle attachments
-			if disposition == "attachment" {
-				filename := "attachment"
+			contentTypeName := typeParams["name"]
+
+			// Handle embedded images referenced from the HTML body, which may also carry a filename
+			contentID := strings.Trim(part.Header.Get("Content-Id"), "<> ")
+			if disposition != "attachment" && !strings.HasPrefix(partMediaType, "text/") &&
+				(contentID != "" || disposition == "inline") {
+				filename := dispositionParams["filename"]
+				if filename == "" {
+					filename = contentTypeName
+				}
+				if filename == "" {
+					unnamed++
+					filename = fallbackFilename(partMediaType, unnamed, usedNames)
+				}
+				usedNames[filename] = true
+
+				inlineImages = append(inlineImages, InlineImage{
+					ContentID:   contentID,
+					Filename:    filename,
+					ContentType: partMediaType,
+					Data:        body,
+				})
+
+				continue
+			}
+
+			// Handle attachments. Older mailers (e.g. Outlook) omit Content-Disposition and only
+			// name the file in the Content-Type "name" parameter, so treat named non-text parts as attachments too.
+			isUndisposedAttachment := disposition == "" && contentTypeName != "" && !strings.HasPrefix(partMediaType, "text/")
+			// Named inline text is body content by default, but some mailers use it for
+			// supplementary files (`forward.inline_text_as_body: false`)
+			isInlineTextAttachment := !inlineTextAsBody && disposition == "inline" &&
+				dispositionParams["filename"] != "" && strings.HasPrefix(partMediaType, "text/")
 
-				if cd := part.Header.Get("Content-Disposition"); cd != "" {
-					_, params, err := mime.ParseMediaType(cd)
+			if disposition == "attachment" || isUndisposedAttachment || isInlineTextAttachment {
+				// go-message decodes RFC 2231 and RFC 2047 encoded names (e.g. =?UTF-8?B?...?=)
+				filename := dispositionParams["filename"]
 
-					if err == nil {
-						if name, ok := params["filename"]; ok {
-							filename = name
-						}
-					}
+				if filename == "" && contentTypeName != "" {
+					filename = contentTypeName
 				}
 
+				// Give unnamed attachments distinct names, so recipients can tell them apart
+				if filename == "" {
+					unnamed++
+					filename = fallbackFilename(partMediaType, unnamed, usedNames)
+				}
+				usedNames[filename] = true
+
 				attachments = append(attachments, Attachment{
 					Filename:    filename,
 					ContentType: partMediaType,
 					Data:        body,
+					Headers:     attachmentHeaders(part.Header),
 				})
 
 				continue
 			}
 
-			// Handle inline parts (body content)
+			// Handle inline parts (body content). Later parts replace earlier ones unless
+			// `forward.concat_body_parts` is set, for mailers that split the body across parts.
 			switch partMediaType {
 			case "text/plain":
-				text = string(body)
+				text = joinBodyPart(text, string(body), concat, "\n\n")
 			case "text/html":
-				html = string(body)
+				html = joinBodyPart(html, string(body), concat, "\n<hr>\n")
 			}
 		}
+	}
+
+	// Get content type of the top-level entity (e.g. multipart/mixed)
+	mediaType, _, _ := entity.Header.ContentType()
+
+	// If it's multipart (e.g. mixed or alternative), walk through its parts
+	if strings.HasPrefix(mediaType, "multipart/") {
+		walk(entity.MultipartReader())
 	} else {
 		// Not multipart: could be just plain text or HTML
 		body, err := io.ReadAll(entity.Body)
 		if err != nil {
 			slog.Error("Failed to read body", "error", err)
-			return "", "", attachments
+			return "", "", attachments, inlineImages
 		}
 
 		switch mediaType {
@@ -92,5 +156,64 @@ func extractBodies(entity *message.Entity) (string, string, []Attachment) {
 		}
 	}
 
-	return text, html, attachments
+	return text, html, attachments, inlineImages
+}
+
+// isUnknownCharset reports whether err only says that a charset or transfer encoding isn't
+// supported; go-message then still returns an entity with the undecoded body
+func isUnknownCharset(err error) bool {
+	return err != nil && (message.IsUnknownCharset(err) || message.IsUnknownEncoding(err))
+}
+
+// fallbackFilename names the n-th attachment without a filename `attachment-N.ext`, with the
+// extension derived from its content type, counting up if that name is already taken
+func fallbackFilename(mediaType string, n int, used map[string]bool) string {
+	ext := ".bin"
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	for ; ; n++ {
+		name := fmt.Sprintf("attachment-%d%s", n, ext)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+// joinBodyPart appends part to the body collected so far, separated by sep, or replaces it
+// when concat is off. An empty part never replaces a body that was already found.
+func joinBodyPart(body, part string, concat bool, sep string) string {
+	if strings.TrimSpace(part) == "" && body != "" {
+		return body
+	}
+	if !concat || body == "" {
+		return part
+	}
+	return body + sep + part
+}
+
+// attachmentHeaders collects the metadata headers of an attachment part that are re-applied
+// when forwarding: Content-ID, Content-Description and any custom X- headers
+func attachmentHeaders(h message.Header) map[string][]string {
+	headers := make(map[string][]string)
+	fields := h.Fields()
+	for fields.Next() {
+		key := textproto.CanonicalMIMEHeaderKey(fields.Key())
+		if key != "Content-Id" && key != "Content-Description" && !strings.HasPrefix(key, "X-") {
+			continue
+		}
+		if key == "Content-Id" {
+			key = "Content-ID"
+		}
+		value, err := fields.Text()
+		if err != nil {
+			value = fields.Value()
+		}
+		headers[key] = append(headers[key], value)
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
 }
@@ -1,10 +1,13 @@
 package reflector
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
 	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+	"gopkg.in/gomail.v2"
 )
 
 func TestExtractBodies_TextAndHtml(t *testing.T) {
@@ -29,7 +32,7 @@ Content-Type: text/html
 		t.Fatalf("failed to parse message: %v", err)
 	}
 
-	text, html, attachments := extractBodies(entity)
+	text, html, attachments, _ := extractBodies(entity)
 
 	if text != "This is the plain text version.\n" {
 		t.Errorf("unexpected text body: %q", text)
@@ -43,3 +46,414 @@ Content-Type: text/html
 		t.Errorf("unexpected attachments found")
 	}
 }
+
+func TestExtractBodies_AttachmentWithoutDisposition(t *testing.T) {
+	t.Parallel()
+
+	raw := `Content-Type: multipart/mixed; boundary="xyz"
+
+--xyz
+Content-Type: text/plain
+
+See attached report.
+
+--xyz
+Content-Type: application/pdf; name="report.pdf"
+
+%PDF-1.4 fake
+
+--xyz--`
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	text, _, attachments, _ := extractBodies(entity)
+
+	if text != "See attached report.\n" {
+		t.Errorf("unexpected text body: %q", text)
+	}
+
+	if len(attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(attachments))
+	}
+
+	if attachments[0].Filename != "report.pdf" {
+		t.Errorf("unexpected filename: %q", attachments[0].Filename)
+	}
+
+	if attachments[0].ContentType != "application/pdf" {
+		t.Errorf("unexpected content type: %q", attachments[0].ContentType)
+	}
+}
+
+func TestAttachmentHeadersRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	raw := `Content-Type: multipart/mixed; boundary="xyz"
+
+--xyz
+Content-Type: text/plain
+
+See attached logo.
+
+--xyz
+Content-Type: image/png; name="logo.png"
+Content-Disposition: attachment; filename="logo.png"
+Content-ID: <logo@example.org>
+Content-Description: Company logo
+X-Archive-Ref: 4711
+
+PNGDATA
+--xyz--`
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	_, _, attachments, _ := extractBodies(entity)
+	if len(attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(attachments))
+	}
+
+	msg := gomail.NewMessage()
+	msg.SetBody("text/plain", "See attached logo.")
+	attachFiles(msg, attachments)
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	forwarded, err := message.Read(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse forwarded message: %v", err)
+	}
+
+	mr := forwarded.MultipartReader()
+	if mr == nil {
+		t.Fatal("expected a multipart message")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal("attachment part not found in forwarded message")
+		}
+		if disposition, _, _ := part.Header.ContentDisposition(); disposition != "attachment" {
+			continue
+		}
+
+		if got := part.Header.Get("Content-ID"); got != "<logo@example.org>" {
+			t.Errorf("unexpected Content-ID: %q", got)
+		}
+		if got := part.Header.Get("Content-Description"); got != "Company logo" {
+			t.Errorf("unexpected Content-Description: %q", got)
+		}
+		if got := part.Header.Get("X-Archive-Ref"); got != "4711" {
+			t.Errorf("unexpected X-Archive-Ref: %q", got)
+		}
+		if mediaType, _, _ := part.Header.ContentType(); mediaType != "image/png" {
+			t.Errorf("unexpected Content-Type: %q", mediaType)
+		}
+		return
+	}
+}
+
+func TestExtractBodies_MultipleTextParts(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	raw := `Content-Type: multipart/mixed; boundary="xyz"
+
+--xyz
+Content-Type: text/plain
+
+First part.
+--xyz
+Content-Type: text/plain
+
+Second part.
+--xyz--`
+
+	read := func() string {
+		entity, err := message.Read(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("failed to parse message: %v", err)
+		}
+		text, _, _, _ := extractBodies(entity)
+		return text
+	}
+
+	if got := read(); got != "Second part." {
+		t.Errorf("expected only the last part by default, got %q", got)
+	}
+
+	viper.Set("forward.concat_body_parts", true)
+	if got := read(); got != "First part.\n\nSecond part." {
+		t.Errorf("expected both parts joined, got %q", got)
+	}
+}
+
+func TestExtractBodies_InlineTextWithFilename(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	raw := `Content-Type: multipart/mixed; boundary="xyz"
+
+--xyz
+Content-Type: text/plain
+
+Main text.
+--xyz
+Content-Type: text/plain
+Content-Disposition: inline; filename="notes.txt"
+
+Supplementary notes.
+--xyz--`
+
+	read := func() (string, []Attachment) {
+		entity, err := message.Read(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("failed to parse message: %v", err)
+		}
+		text, _, attachments, _ := extractBodies(entity)
+		return text, attachments
+	}
+
+	// By default named inline text is body content (the later part wins)
+	if text, attachments := read(); text != "Supplementary notes." || len(attachments) != 0 {
+		t.Errorf("expected inline text as body, got %q and %d attachments", text, len(attachments))
+	}
+
+	viper.Set("forward.inline_text_as_body", false)
+	text, attachments := read()
+	if text != "Main text." {
+		t.Errorf("expected only the unnamed part as body, got %q", text)
+	}
+	if len(attachments) != 1 || attachments[0].Filename != "notes.txt" || string(attachments[0].Data) != "Supplementary notes." {
+		t.Errorf("expected notes.txt as attachment, got %+v", attachments)
+	}
+}
+
+func TestExtractBodies_UnnamedAttachments(t *testing.T) {
+	t.Parallel()
+
+	raw := `Content-Type: multipart/mixed; boundary="xyz"
+
+--xyz
+Content-Type: text/plain
+
+Two files attached.
+--xyz
+Content-Type: application/pdf
+Content-Disposition: attachment
+
+%PDF-1.4 fake
+--xyz
+Content-Type: application/x-unknown-type
+Content-Disposition: attachment
+
+data
+--xyz--`
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	_, _, attachments, _ := extractBodies(entity)
+	if len(attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(attachments))
+	}
+	if attachments[0].Filename != "attachment-1.pdf" {
+		t.Errorf("unexpected first filename: %q", attachments[0].Filename)
+	}
+	if attachments[1].Filename != "attachment-2.bin" {
+		t.Errorf("unexpected second filename: %q", attachments[1].Filename)
+	}
+}
+
+func TestExtractBodies_TransferEncodings(t *testing.T) {
+	t.Parallel()
+
+	raw := "Content-Type: multipart/alternative; boundary=\"xyz\"\r\n" +
+		"\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Sch=C3=B6ne Gr=C3=BC=C3=9Fe, K=C3=A4se f=C3=BCr alle, und eine sehr lange Zeile=\r\n" +
+		" die umbrochen wurde\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PHA+S8Okc2UgJmFtcDsgQnJvdDwvcD4=\r\n" +
+		"--xyz--\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	text, html, _, _ := extractBodies(entity)
+
+	if text != "Schöne Grüße, Käse für alle, und eine sehr lange Zeile die umbrochen wurde" {
+		t.Errorf("unexpected text body: %q", text)
+	}
+	if html != "<p>Käse &amp; Brot</p>" {
+		t.Errorf("unexpected HTML body: %q", html)
+	}
+}
+
+func TestExtractBodies_Latin1(t *testing.T) {
+	t.Parallel()
+
+	raw := "Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"K=E4se\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	if text, _, _, _ := extractBodies(entity); text != "Käse\r\n" {
+		t.Errorf("expected the body converted to UTF-8, got %q", text)
+	}
+}
+
+func TestExtractBodies_UnknownCharset(t *testing.T) {
+	t.Parallel()
+
+	raw := "Content-Type: multipart/alternative; boundary=\"xyz\"\r\n" +
+		"\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/plain; charset=x-made-up\r\n" +
+		"\r\n" +
+		"plain bytes\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/html; charset=windows-1252\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>Gr=FC=DFe =80</p>\r\n" +
+		"--xyz--\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	text, html, _, _ := extractBodies(entity)
+
+	if text != "plain bytes" {
+		t.Errorf("expected the unknown charset to pass through unchanged, got %q", text)
+	}
+	if html != "<p>Grüße €</p>" {
+		t.Errorf("expected the parts after it to be converted, got %q", html)
+	}
+}
+
+func TestExtractBodies_NestedMultipart(t *testing.T) {
+	t.Parallel()
+
+	raw := "Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Plain version\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>HTML version</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=\"agenda.pdf\"\r\n" +
+		"\r\n" +
+		"%PDF-1.4\r\n" +
+		"--outer--\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	text, html, attachments, _ := extractBodies(entity)
+
+	if text != "Plain version" {
+		t.Errorf("unexpected text body: %q", text)
+	}
+	if html != "<p>HTML version</p>" {
+		t.Errorf("unexpected HTML body: %q", html)
+	}
+	if len(attachments) != 1 || attachments[0].Filename != "agenda.pdf" {
+		t.Errorf("expected the PDF attachment, got %+v", attachments)
+	}
+}
+
+func TestExtractBodies_InlineImages(t *testing.T) {
+	t.Parallel()
+
+	raw := "Content-Type: multipart/related; boundary=\"xyz\"\r\n" +
+		"\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<img src=\"cid:logo@example.org\"><img src=\"cid:photo\">\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: <logo@example.org>\r\n" +
+		"\r\n" +
+		"PNGDATA\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: image/jpeg\r\n" +
+		"Content-Disposition: inline; filename=\"photo.jpg\"\r\n" +
+		"Content-ID: <photo>\r\n" +
+		"\r\n" +
+		"JPEGDATA\r\n" +
+		"--xyz--\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	_, html, attachments, images := extractBodies(entity)
+	if len(attachments) != 0 {
+		t.Errorf("expected no attachments, got %+v", attachments)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected 2 inline images, got %+v", images)
+	}
+	if images[0].ContentID != "logo@example.org" || images[0].Filename != "attachment-1.png" {
+		t.Errorf("unexpected first image: %+v", images[0])
+	}
+	if images[1].ContentID != "photo" || images[1].Filename != "photo.jpg" || string(images[1].Data) != "JPEGDATA" {
+		t.Errorf("unexpected second image: %+v", images[1])
+	}
+
+	msg := gomail.NewMessage()
+	msg.SetBody("text/html", html)
+	embedImages(msg, images, true)
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"multipart/related", "Content-ID: <logo@example.org>", "Content-ID: <photo>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the forwarded message", want)
+		}
+	}
+}
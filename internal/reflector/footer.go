@@ -0,0 +1,26 @@
+package reflector
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// appendTextFooter appends `forward.footer_text` to a non-empty text/plain body
+func appendTextFooter(text string) string {
+	footer := viper.GetString("forward.footer_text")
+	if footer == "" || strings.TrimSpace(text) == "" {
+		return text
+	}
+	return strings.TrimRight(text, "\r\n") + "\n\n" + strings.TrimRight(footer, "\r\n") + "\n"
+}
+
+// appendHTMLFooter appends `forward.footer_html` to a non-empty HTML body, inside <body> when
+// there is one. The footer is inserted as configured, without escaping.
+func appendHTMLFooter(body string) string {
+	footer := viper.GetString("forward.footer_html")
+	if footer == "" || strings.TrimSpace(body) == "" {
+		return body
+	}
+	return insertBeforeBodyEnd(body, footer)
+}
@@ -0,0 +1,34 @@
+package reflector
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFooters(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	text, html := "Hello\n", "<html><body><p>Hello</p></body></html>"
+	if appendTextFooter(text) != text || appendHTMLFooter(html) != html {
+		t.Error("expected bodies to be unchanged without footers")
+	}
+
+	viper.Set("forward.footer_text", "To unsubscribe, reply with STOP.")
+	viper.Set("forward.footer_html", "<p>To unsubscribe, reply with STOP.</p>")
+
+	if got, want := appendTextFooter(text), "Hello\n\nTo unsubscribe, reply with STOP.\n"; got != want {
+		t.Errorf("unexpected text body: %q, want %q", got, want)
+	}
+	if got, want := appendHTMLFooter(html), "<html><body><p>Hello</p><p>To unsubscribe, reply with STOP.</p></body></html>"; got != want {
+		t.Errorf("unexpected HTML body: %q, want %q", got, want)
+	}
+	if got, want := appendHTMLFooter("<b>Hi</b>"), "<b>Hi</b><p>To unsubscribe, reply with STOP.</p>"; got != want {
+		t.Errorf("unexpected HTML fragment: %q, want %q", got, want)
+	}
+
+	// A body that doesn't exist doesn't get a footer
+	if appendTextFooter("") != "" || appendHTMLFooter("") != "" {
+		t.Error("expected missing bodies to stay empty")
+	}
+}
@@ -0,0 +1,197 @@
+package reflector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/meko-christian/mail-reflector/internal/metrics"
+	"github.com/spf13/viper"
+)
+
+// forwardingEnabled reports whether forwarding is active. Setting `enabled: false` (or Pause)
+// pauses forwarding: matching messages are still detected but left unseen until it's re-enabled.
+func forwardingEnabled() bool {
+	if pausedAtRuntime.Load() {
+		return false
+	}
+	return !viper.IsSet("enabled") || viper.GetBool("enabled")
+}
+
+// waitInterMessageDelay pauses for `forward.inter_message_delay` between consecutive forwards
+// to spread bursts out. It returns false if ctx was cancelled while waiting.
+func waitInterMessageDelay(ctx context.Context) bool {
+	delay := viper.GetDuration("forward.inter_message_delay")
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	slog.Debug("Waiting before forwarding the next message", "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// skipMessage records mail as skipped for reason in the state store and marks it as seen, or
+// queues it on batch to be marked as seen later
+func skipMessage(c *client.Client, store *stateStore, mail MailSummary, batch *seenBatch, result MessageResult, reason string) (MessageResult, error) {
+	if store != nil && mail.Envelope != nil && mail.Envelope.MessageId != "" {
+		if err := store.setForwardStatus(mail.Envelope.MessageId, mail.Envelope.Subject, forwardStatusSkipped); err != nil {
+			slog.Warn("Could not record skipped mail in state file", "uid", mail.UID, "error", err)
+		}
+	}
+	result.Status, result.Reason = MessageSkipped, reason
+	if batch != nil {
+		batch.add(mail.UID)
+		return result, nil
+	}
+	return result, markAsSeenWithRecovery(c, mail.UID)
+}
+
+// forwardMessage forwards a single matching message and marks it as seen, or queues it
+// on batch to be marked as seen later when batching is enabled (batch may be nil). The
+// forward is sent over session, or over a connection of its own if session is nil.
+// With a state store configured, an idempotency record is written before sending and
+// updated afterwards, so a crash between forwarding and marking as seen doesn't
+// cause the message to be forwarded twice.
+func forwardMessage(ctx context.Context, c *client.Client, mail MailSummary, batch *seenBatch, session *smtpSession) error {
+	_, err := forwardMessageWithResult(ctx, c, mail, batch, session)
+	return err
+}
+
+// forwardMessageWithResult is forwardMessage, additionally reporting what happened to the message
+func forwardMessageWithResult(ctx context.Context, c *client.Client, mail MailSummary, batch *seenBatch, session *smtpSession) (result MessageResult, err error) {
+	result = newMessageResult(mail)
+	defer func() {
+		status := result.Status
+		if err != nil && status != MessageForwarded {
+			status = MessageFailed
+		}
+		switch status {
+		case MessageForwarded:
+			metrics.MessagesForwarded.Inc()
+		case MessageFailed:
+			metrics.MessagesFailed.Inc()
+		}
+		recordSummary(status)
+	}()
+
+	store := getStateStore()
+	messageID := ""
+	if mail.Envelope != nil {
+		messageID = mail.Envelope.MessageId
+	}
+
+	// The content hash is taken before any policy below alters the bodies
+	hash := ""
+	if store != nil && contentDedupEnabled() {
+		hash = contentHash(mail)
+	}
+
+	// Encrypted messages are passed through intact, or skipped
+	if !applyEncryptedPolicy(mail) {
+		return skipMessage(c, store, mail, batch, result, "encrypted")
+	}
+
+	// Oversized messages are either replaced by a preview or only marked as seen
+	mail, ok := applySizeLimit(mail)
+	if !ok {
+		return skipMessage(c, store, mail, batch, result, "exceeds size limit")
+	}
+
+	// Attachments flagged by the scanner are stripped, or the message is skipped or quarantined
+	mail, ok, reason := applyAttachmentScan(mail)
+	if !ok {
+		if err := quarantineMessage(c, mail.UID); err != nil {
+			return result.failed(err)
+		}
+		return skipMessage(c, store, mail, batch, result, reason)
+	}
+
+	if store != nil && messageID != "" {
+		switch store.forwardStatus(messageID) {
+		case forwardStatusForwarded:
+			// Forwarded before, but the process stopped (or confirmation failed) before marking it as seen
+			slog.Info("Message was already forwarded, only marking as seen", "uid", mail.UID, "message_id", messageID)
+			result.Status, result.Reason = MessageSkipped, "already forwarded"
+			if err := confirmDelivery(mail); err != nil {
+				return result.failed(err)
+			}
+			if batch != nil {
+				batch.add(mail.UID)
+				return result, nil
+			}
+			return result, markAsSeenWithRecovery(c, mail.UID)
+		case forwardStatusForwarding:
+			slog.Warn("Previous forward of this message was interrupted, forwarding again", "uid", mail.UID, "message_id", messageID)
+		}
+	}
+
+	// The same content resent under a new Message-ID is only forwarded once per `dedup.window`
+	if hash != "" {
+		if at, seen := store.contentSeen(hash, dedupWindow()); seen {
+			slog.Info("Message content was already forwarded, skipping duplicate", "uid", mail.UID, "message_id", messageID, "forwarded_at", at)
+			return skipMessage(c, store, mail, batch, result, "duplicate content")
+		}
+	}
+
+	// Stay within `smtp.rate_limit`; a cancelled wait leaves the message for the next run
+	if err := waitForSMTPRateLimit(ctx); err != nil {
+		return result.failed(err)
+	}
+
+	if store != nil && messageID != "" {
+		if err := store.setForwardStatus(messageID, mail.Envelope.Subject, forwardStatusForwarding); err != nil {
+			slog.Warn("Could not record forward in state file", "uid", mail.UID, "error", err)
+		}
+	}
+
+	started := time.Now()
+	err = forwardMail(c, session, mail, resolveFromAddress(mail))
+	metrics.ForwardDuration.Observe(time.Since(started).Seconds())
+	if err != nil {
+		forwardErr := fmt.Errorf("failed to forward: %w", err)
+		if err := handleFailedForward(c, store, mail, forwardErr); err != nil {
+			return result.failed(err)
+		}
+		result.Status, result.Reason = MessageFailed, "given up: "+forwardErr.Error()
+		return result, nil
+	}
+	result.Status = MessageForwarded
+
+	runForwardHook(mail, len(viper.GetStringSlice("recipients")))
+
+	if store != nil && messageID != "" {
+		if err := store.setForwardStatus(messageID, mail.Envelope.Subject, forwardStatusForwarded); err != nil {
+			slog.Warn("Could not record forward in state file", "uid", mail.UID, "error", err)
+		}
+	}
+	if hash != "" {
+		if err := store.recordContentHash(hash, dedupWindow()); err != nil {
+			slog.Warn("Could not record content hash in state file", "uid", mail.UID, "error", err)
+		}
+	}
+
+	// Only mark as seen once the forward is confirmed downstream (immediately by default)
+	if err := confirmDelivery(mail); err != nil {
+		return result, err
+	}
+
+	if batch != nil {
+		batch.add(mail.UID)
+		return result, nil
+	}
+
+	if err := markAsSeenWithRecovery(c, mail.UID); err != nil {
+		return result, fmt.Errorf("forwarded but could not mark as seen: %w", err)
+	}
+
+	return result, nil
+}
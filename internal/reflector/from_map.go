@@ -0,0 +1,62 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// FromMapping selects the outgoing From address for mails from a specific sender
+type FromMapping struct {
+	Sender string `mapstructure:"sender"`
+	From   string `mapstructure:"from"`
+}
+
+// fromMappings loads the `forward.from_map` list from config
+func fromMappings() []FromMapping {
+	var mappings []FromMapping
+	if err := viper.UnmarshalKey("forward.from_map", &mappings); err != nil {
+		slog.Warn("Could not parse forward.from_map, ignoring it", "error", err)
+		return nil
+	}
+	return mappings
+}
+
+// ValidateFromMap checks that every configured from_map entry has a valid sender and From address
+func ValidateFromMap() []error {
+	var errs []error
+	for i, m := range fromMappings() {
+		if m.Sender == "" {
+			errs = append(errs, fmt.Errorf("forward.from_map[%d]: sender is empty", i))
+		}
+		if _, err := mail.ParseAddress(m.From); err != nil {
+			errs = append(errs, fmt.Errorf("forward.from_map[%d]: invalid from address %q: %w", i, m.From, err))
+		}
+	}
+	return errs
+}
+
+// resolveFromAddress picks the outgoing From address for a matched message:
+// the from_map entry for its sender if one exists, otherwise the SMTP identity.
+func resolveFromAddress(original MailSummary) string {
+	sender := strings.ToLower(getFromAddress(original.Envelope))
+
+	for _, m := range fromMappings() {
+		if strings.ToLower(m.Sender) != sender {
+			continue
+		}
+
+		if _, err := mail.ParseAddress(m.From); err != nil {
+			slog.Warn("Ignoring invalid from_map address", "sender", m.Sender, "from", m.From, "error", err)
+			break
+		}
+
+		slog.Debug("Using mapped From address", "sender", sender, "from", m.From)
+		return m.From
+	}
+
+	return viper.GetString("smtp.username")
+}
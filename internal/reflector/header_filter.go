@@ -0,0 +1,127 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/mail"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// filterHeaderFields are the headers fetched for the matching decision in header-only mode
+var filterHeaderFields = []string{"From", "Subject", "Date", "Message-Id", "List-Id"}
+
+// matchHeaderFields fetches only the filter-relevant header fields of a message
+// (BODY.PEEK[HEADER.FIELDS (...)]) and decides whether it matches the sender filter.
+// Real header parsing is more robust than the server's envelope and avoids downloading
+// non-matching messages entirely.
+func matchHeaderFields(client *client.Client, uid uint32, filters []string) (bool, error) {
+	header, err := fetchHeaderFields(client, uid)
+	if err != nil {
+		return false, err
+	}
+
+	subjectPatterns := viper.GetStringSlice("filter.subject")
+
+	from, err := header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		slog.Debug("Could not parse From header, treating as non-matching", "uid", uid, "from", header.Get("From"), "error", err)
+		return false, nil
+	}
+
+	if !isSenderMatching(from[0].Address, filters, len(subjectPatterns) > 0) {
+		slog.Debug("Message does not match filter (header-only)", "uid", uid, "from", from[0].Address)
+		return false, nil
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		subject = header.Get("Subject")
+	}
+	if !matchSubject(subject, subjectPatterns) {
+		slog.Debug("Message does not match subject filter (header-only)", "uid", uid, "subject", subject)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// fetchHeaderFields downloads and parses the filter-relevant header fields of a single message
+func fetchHeaderFields(client *client.Client, uid uint32) (mail.Header, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: filterHeaderFields},
+		Peek:         true,
+	}
+
+	messages := make(chan *imap.Message, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- client.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var msg *imap.Message
+	fetchDone := false
+	select {
+	case msg = <-messages:
+	case err := <-errCh:
+		fetchDone = true
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch headers of message %d: %w", uid, err)
+		}
+		msg = <-messages
+	case <-time.After(defaultIMAPTimeout):
+		return nil, fmt.Errorf("header fetch for message %d timed out after %v", uid, defaultIMAPTimeout)
+	}
+
+	if msg == nil {
+		return nil, fmt.Errorf("no message received for UID %d", uid)
+	}
+
+	literal := msg.GetBody(section)
+	if literal == nil {
+		return nil, fmt.Errorf("no header fields returned for message %d", uid)
+	}
+
+	raw, err := io.ReadAll(literal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read headers of message %d: %w", uid, err)
+	}
+
+	// Wait for the fetch command to complete before the connection is reused
+	if !fetchDone {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				slog.Debug("Header fetch finished with error", "uid", uid, "error", err)
+			}
+		case <-time.After(defaultIMAPTimeout):
+			return nil, fmt.Errorf("header fetch for message %d did not complete after %v", uid, defaultIMAPTimeout)
+		}
+	}
+
+	return parseHeaderFields(raw)
+}
+
+// parseHeaderFields parses a raw header block as returned by BODY[HEADER.FIELDS (...)]
+func parseHeaderFields(raw []byte) (mail.Header, error) {
+	// The header block ends with an empty line; make sure one is present for the parser
+	if !bytes.HasSuffix(raw, []byte("\r\n\r\n")) && !bytes.HasSuffix(raw, []byte("\n\n")) {
+		raw = append(raw, "\r\n"...)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse header fields: %w", err)
+	}
+	return m.Header, nil
+}
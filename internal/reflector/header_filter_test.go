@@ -0,0 +1,31 @@
+package reflector
+
+import "testing"
+
+func TestParseHeaderFields(t *testing.T) {
+	t.Parallel()
+
+	raw := "From: =?UTF-8?Q?J=C3=BCrgen_M=C3=BCller?= <Vorstand@Example.com>\r\nSubject: Einladung\r\n"
+
+	header, err := parseHeaderFields([]byte(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	from, err := header.AddressList("From")
+	if err != nil || len(from) != 1 {
+		t.Fatalf("failed to parse From: %v", err)
+	}
+
+	if from[0].Name != "Jürgen Müller" {
+		t.Errorf("unexpected display name: %q", from[0].Name)
+	}
+
+	if !isAddressMatching(from[0].Address, []string{"vorstand@example.com"}) {
+		t.Errorf("expected %q to match the filter case-insensitively", from[0].Address)
+	}
+
+	if header.Get("Subject") != "Einladung" {
+		t.Errorf("unexpected subject: %q", header.Get("Subject"))
+	}
+}
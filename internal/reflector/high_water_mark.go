@@ -0,0 +1,80 @@
+package reflector
+
+import (
+	"log/slog"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+// highWaterMarkStore returns the state store if `processing.use_high_water_mark` is enabled.
+// With a high-water mark, `check` considers all mail above the UID processed by the previous
+// run instead of unread mail, so people reading the shared mailbox don't hide new messages.
+func highWaterMarkStore() *stateStore {
+	if !viper.GetBool("processing.use_high_water_mark") {
+		return nil
+	}
+	store := getStateStore()
+	if store == nil {
+		slog.Warn("processing.use_high_water_mark needs state.file, searching unread mail instead")
+	}
+	return store
+}
+
+// highWaterMarkCriteria returns search criteria for mail above the recorded high-water mark and
+// the mark itself. Without a mark for the current UIDVALIDITY (first run, or the mailbox was
+// recreated), it falls back to searching unread mail.
+func highWaterMarkCriteria(store *stateStore, status *imap.MailboxStatus) (*imap.SearchCriteria, uint32) {
+	criteria := imap.NewSearchCriteria()
+	mark, ok := store.highWaterMark(status.UidValidity)
+	if !ok {
+		slog.Info("No high-water mark recorded yet, searching unread mail")
+		criteria.WithoutFlags = []string{imap.SeenFlag}
+		return criteria, 0
+	}
+
+	slog.Debug("Searching mail above the high-water mark", "uid", mark)
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(mark+1, 0) // mark+1:*
+	return criteria, mark
+}
+
+// aboveHighWaterMark drops UIDs up to mark. A `n:*` search always includes the highest UID of
+// the mailbox, even if that is below n, so the results need to be filtered.
+func aboveHighWaterMark(uids []uint32, mark uint32) []uint32 {
+	above := uids[:0]
+	for _, uid := range uids {
+		if uid > mark {
+			above = append(above, uid)
+		}
+	}
+	return above
+}
+
+// advanceHighWaterMark records how far `check` got: up to the newest message if everything was
+// processed, otherwise to just below the first message that failed, so it is retried next run
+func advanceHighWaterMark(store *stateStore, status *imap.MailboxStatus, mails []MailSummary, failed []uint32) {
+	if store == nil || status == nil {
+		return
+	}
+
+	next := uint32(0)
+	if status.UidNext > 0 {
+		next = status.UidNext - 1
+	}
+	for _, mail := range mails {
+		next = max(next, mail.UID)
+	}
+	for _, uid := range failed {
+		next = min(next, uid-1)
+	}
+
+	if mark, ok := store.highWaterMark(status.UidValidity); ok && next <= mark {
+		return
+	}
+	if err := store.setHighWaterMark(next, status.UidValidity); err != nil {
+		slog.Warn("Could not record high-water mark in state file", "error", err)
+		return
+	}
+	slog.Debug("High-water mark advanced", "uid", next)
+}
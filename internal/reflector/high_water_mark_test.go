@@ -0,0 +1,49 @@
+package reflector
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestHighWaterMark(t *testing.T) {
+	t.Parallel()
+
+	store, err := loadStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	status := &imap.MailboxStatus{UidNext: 11, UidValidity: 7}
+
+	// Without a mark, the first run searches unread mail
+	criteria, mark := highWaterMarkCriteria(store, status)
+	if mark != 0 || criteria.Uid != nil || !slices.Contains(criteria.WithoutFlags, imap.SeenFlag) {
+		t.Fatalf("expected an unread search without a mark, got %+v (mark %d)", criteria, mark)
+	}
+
+	// A failed forward holds the mark back so the message is retried
+	advanceHighWaterMark(store, status, []MailSummary{{UID: 8}, {UID: 9}}, []uint32{9})
+	if mark, _ := store.highWaterMark(7); mark != 8 {
+		t.Errorf("expected the mark below the failed message, got %d", mark)
+	}
+
+	advanceHighWaterMark(store, status, []MailSummary{{UID: 9}}, nil)
+	if mark, _ := store.highWaterMark(7); mark != 10 {
+		t.Errorf("expected the mark at the newest message, got %d", mark)
+	}
+
+	criteria, mark = highWaterMarkCriteria(store, status)
+	if mark != 10 || criteria.Uid == nil || len(criteria.WithoutFlags) != 0 {
+		t.Fatalf("expected a UID search above the mark, got %+v (mark %d)", criteria, mark)
+	}
+	if got := aboveHighWaterMark([]uint32{10, 11, 12}, mark); !slices.Equal(got, []uint32{11, 12}) {
+		t.Errorf("unexpected UIDs above the mark: %v", got)
+	}
+
+	// A new UIDVALIDITY invalidates the mark
+	if _, ok := store.highWaterMark(8); ok {
+		t.Error("mark should not apply to another UIDVALIDITY")
+	}
+}
@@ -0,0 +1,102 @@
+package reflector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultHookTimeout limits how long a hook command may run before it is killed
+const defaultHookTimeout = 30 * time.Second
+
+// hooksWG tracks running hooks so short-lived commands like `check` can wait for them
+var hooksWG sync.WaitGroup
+
+// forwardHookPayload is passed as JSON on stdin to the `hooks.on_forward` command
+type forwardHookPayload struct {
+	From           string `json:"from"`
+	Subject        string `json:"subject"`
+	MessageID      string `json:"message_id"`
+	RecipientCount int    `json:"recipient_count"`
+}
+
+// runForwardHook starts the `hooks.on_forward` command for a successfully forwarded message
+// in the background. Its metadata is passed both as MAIL_REFLECTOR_* environment variables
+// and as a JSON payload on stdin. Failures are logged and never affect forwarding.
+func runForwardHook(mail MailSummary, recipientCount int) {
+	args := viper.GetStringSlice("hooks.on_forward")
+	if len(args) == 0 {
+		return
+	}
+
+	payload := forwardHookPayload{
+		From:           getFromAddress(mail.Envelope),
+		RecipientCount: recipientCount,
+	}
+	if mail.Envelope != nil {
+		payload.Subject = mail.Envelope.Subject
+		payload.MessageID = mail.Envelope.MessageId
+	}
+
+	timeout := defaultHookTimeout
+	if viper.IsSet("hooks.timeout") {
+		timeout = viper.GetDuration("hooks.timeout")
+	}
+
+	hooksWG.Add(1)
+	go func() {
+		defer hooksWG.Done()
+		if err := execHook(args, payload, timeout); err != nil {
+			slog.Warn("Forward hook failed", "command", args[0], "uid", mail.UID, "error", err)
+		}
+	}()
+}
+
+// execHook runs a hook command with the payload and waits for it to finish or time out
+func execHook(args []string, payload forwardHookPayload, timeout time.Duration) error {
+	var stdin bytes.Buffer
+	enc := json.NewEncoder(&stdin)
+	enc.SetEscapeHTML(false) // keep Message-IDs like <id@host> readable
+	if err := enc.Encode(payload); err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = &stdin
+	// Don't wait for output pipes held open by children of a killed command
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"MAIL_REFLECTOR_FROM="+payload.From,
+		"MAIL_REFLECTOR_SUBJECT="+payload.Subject,
+		"MAIL_REFLECTOR_MESSAGE_ID="+payload.MessageID,
+		"MAIL_REFLECTOR_RECIPIENT_COUNT="+strconv.Itoa(payload.RecipientCount),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w (output: %q)", err, bytes.TrimSpace(output))
+	}
+
+	slog.Debug("Forward hook finished", "command", args[0], "output", string(bytes.TrimSpace(output)))
+	return nil
+}
+
+// waitForHooks waits for running hooks to finish, so they aren't cut off when the process exits
+func waitForHooks() {
+	hooksWG.Wait()
+}
@@ -0,0 +1,42 @@
+package reflector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecHook(t *testing.T) {
+	t.Parallel()
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("requires /bin/sh")
+	}
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+	payload := forwardHookPayload{From: "jane@example.com", Subject: "Einladung", MessageID: "<1@example.com>", RecipientCount: 3}
+
+	script := `printf '%s|%s|' "$MAIL_REFLECTOR_FROM" "$MAIL_REFLECTOR_RECIPIENT_COUNT" > "$0"; cat >> "$0"`
+	if err := execHook([]string{"/bin/sh", "-c", script, out}, payload, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook didn't write output: %v", err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "jane@example.com|3|") || !strings.Contains(got, `"message_id":"<1@example.com>"`) {
+		t.Errorf("unexpected hook output: %s", got)
+	}
+
+	if err := execHook([]string{"/bin/sh", "-c", "exit 3"}, payload, 5*time.Second); err == nil {
+		t.Error("expected error for non-zero exit")
+	}
+
+	if err := execHook([]string{"/bin/sh", "-c", "sleep 5"}, payload, 50*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
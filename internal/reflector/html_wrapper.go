@@ -0,0 +1,54 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// htmlWrapperData is passed to the `forward.html_wrapper` template
+type htmlWrapperData struct {
+	Body    template.HTML // original HTML body, injected without escaping
+	Subject string
+	From    string
+}
+
+// renderHTMLWrapper executes the wrapper template at path around the given data
+func renderHTMLWrapper(path string, data htmlWrapperData) (string, error) {
+	tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML wrapper template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render HTML wrapper template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// wrapHTMLBody wraps the original HTML body into the configured branded layout.
+// The body is returned unchanged when no wrapper is configured or rendering fails.
+func wrapHTMLBody(original MailSummary) string {
+	path := viper.GetString("forward.html_wrapper")
+	if path == "" || original.HTMLBody == "" {
+		return original.HTMLBody
+	}
+
+	wrapped, err := renderHTMLWrapper(path, htmlWrapperData{
+		Body:    template.HTML(original.HTMLBody), // the original HTML is forwarded as-is by design
+		Subject: original.Envelope.Subject,
+		From:    getFromAddress(original.Envelope),
+	})
+	if err != nil {
+		slog.Warn("Could not apply HTML wrapper, forwarding HTML unchanged", "template", path, "error", err)
+		return original.HTMLBody
+	}
+
+	return wrapped
+}
@@ -0,0 +1,31 @@
+package reflector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderHTMLWrapper(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "wrapper.html")
+	layout := `<html><body><h1>{{.Subject}}</h1>{{.Body}}<footer>{{.From}}</footer></body></html>`
+	if err := os.WriteFile(path, []byte(layout), 0o600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	got, err := renderHTMLWrapper(path, htmlWrapperData{
+		Body:    "<p>Tom &amp; Jerry</p>",
+		Subject: "News <1>",
+		From:    "board@example.com",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `<html><body><h1>News &lt;1&gt;</h1><p>Tom &amp; Jerry</p><footer>board@example.com</footer></body></html>`
+	if got != want {
+		t.Errorf("unexpected output:\n got: %s\nwant: %s", got, want)
+	}
+}
@@ -1,7 +1,10 @@
 package reflector
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -15,6 +18,9 @@ import (
 	"github.com/emersion/go-imap-idle"
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	"github.com/emersion/go-sasl"
+	"github.com/meko-christian/mail-reflector/internal/metrics"
 	"github.com/spf13/viper"
 )
 
@@ -38,13 +44,20 @@ const maxFailuresBeforeSkip = 3
 
 // imapConn wraps an IMAP client connection and manages IDLE state safely
 type imapConn struct {
-	c           *client.Client
-	mu          sync.Mutex
-	idling      bool
-	idleStop    chan struct{}
-	idleWG      sync.WaitGroup
-	idler       *idle.Client
-	currentMbox string // track current selected mailbox
+	c              *client.Client
+	mu             sync.Mutex
+	idling         bool
+	closed         bool          // logged out; IDLE must not be started again
+	idleStop       chan struct{} // closed exactly once, by stopIdle while idling is set
+	idleDone       chan struct{} // closed when the last started IDLE goroutine has ended
+	idler          *idle.Client
+	currentMbox    string // track current selected mailbox
+	readOnly       bool   // whether currentMbox was selected read-only (EXAMINE)
+	selectedAt     time.Time
+	selectStale    bool   // IDLE ended since the last SELECT, so its status may be outdated
+	blindPolls     int    // consecutive searches finding nothing while the server reports unseen mail
+	searchTimeouts int    // consecutive UID searches that timed out
+	baselineUID    uint32 // messages up to this UID existed at startup and are ignored (0 = none)
 }
 
 // newImapConn creates a new IMAP connection wrapper
@@ -54,6 +67,19 @@ func newImapConn(client *client.Client) *imapConn {
 	}
 }
 
+// aboveBaseline drops UIDs of messages that already existed when serve started
+func (ic *imapConn) aboveBaseline(uids []uint32) []uint32 {
+	if ic.baselineUID == 0 {
+		return uids
+	}
+	before := len(uids)
+	uids = slices.DeleteFunc(uids, func(uid uint32) bool { return uid <= ic.baselineUID })
+	if ignored := before - len(uids); ignored > 0 {
+		slog.Debug("Ignoring messages that existed at startup", "count", ignored, "baseline_uid", ic.baselineUID)
+	}
+	return uids
+}
+
 // startIdle begins IDLE if not already idling
 func (ic *imapConn) startIdle() error {
 	ic.mu.Lock()
@@ -63,18 +89,25 @@ func (ic *imapConn) startIdle() error {
 		slog.Debug("IDLE already active, skipping")
 		return nil
 	}
+	if ic.closed {
+		// Processing finished after shutdown or a reconnect closed this connection
+		slog.Debug("Connection closed, not starting IDLE")
+		return nil
+	}
 
 	slog.Debug("Starting IMAP IDLE")
 	ic.idler = idle.NewClient(ic.c)
 	ic.idleStop = make(chan struct{})
+	ic.idleDone = make(chan struct{})
 	ic.idling = true
-	ic.idleWG.Add(1)
 
+	// The goroutine gets its own references, as a later startIdle replaces the fields
+	idler, stop, done := ic.idler, ic.idleStop, ic.idleDone
 	go func() {
-		defer ic.idleWG.Done()
+		defer close(done)
 		// IdleWithFallback returns when stop is closed or server doesn't support IDLE
 		// 0 timeout means no automatic timeout - IDLE continues until stop channel is closed
-		err := ic.idler.IdleWithFallback(ic.idleStop, 0)
+		err := idler.IdleWithFallback(stop, 0)
 		if err != nil {
 			slog.Debug("IDLE finished with error", "error", err)
 		} else {
@@ -85,32 +118,34 @@ func (ic *imapConn) startIdle() error {
 	return nil
 }
 
-// stopIdle stops IDLE and waits for it to end
-func (ic *imapConn) stopIdle() {
+// stopIdle stops IDLE and waits for it to end. It is safe to call concurrently and repeatedly:
+// only the call that finds IDLE active closes the stop channel, but every call waits until
+// the IDLE goroutine has ended. It returns false if IDLE didn't end in time, in which case
+// the connection must not be used for other commands.
+func (ic *imapConn) stopIdle() bool {
 	ic.mu.Lock()
-	if !ic.idling {
-		ic.mu.Unlock()
-		slog.Debug("IDLE not active, nothing to stop")
-		return
+	done := ic.idleDone
+	if ic.idling {
+		slog.Debug("Stopping IMAP IDLE")
+		close(ic.idleStop)
+		ic.idling = false
+		ic.selectStale = true
 	}
-
-	slog.Debug("Stopping IMAP IDLE")
-	close(ic.idleStop)
-	ic.idling = false
 	ic.mu.Unlock()
 
-	// Wait for IDLE goroutine to finish with timeout
-	done := make(chan struct{})
-	go func() {
-		ic.idleWG.Wait()
-		close(done)
-	}()
+	if done == nil {
+		slog.Debug("IDLE not active, nothing to stop")
+		return true
+	}
 
+	// Wait for IDLE goroutine to finish with timeout (at once if it already has)
 	select {
 	case <-done:
 		slog.Debug("IDLE stopped successfully")
+		return true
 	case <-time.After(5 * time.Second):
 		slog.Warn("Timed out waiting for IDLE to stop; proceeding anyway")
+		return false
 	}
 }
 
@@ -124,8 +159,14 @@ func (ic *imapConn) withConn(fn func(*client.Client) error) error {
 
 // selectMailbox selects a mailbox if not already selected, tracking state
 func (ic *imapConn) selectMailbox(mailbox string, readOnly bool) (*imap.MailboxStatus, error) {
-	// Skip redundant SELECT if already in the right mailbox
-	if ic.currentMbox == mailbox {
+	// Stop IDLE first, so a selection that IDLE has made stale is noticed
+	ic.stopIdle()
+
+	// Skip redundant SELECT if already in the right mailbox and mode, and the status is current
+	ic.mu.Lock()
+	current := ic.currentMbox == mailbox && ic.readOnly == readOnly && !ic.selectionStale()
+	ic.mu.Unlock()
+	if current {
 		slog.Debug("Mailbox already selected, skipping SELECT", "mailbox", mailbox)
 		return getCurrentMailboxStatus(), nil
 	}
@@ -139,21 +180,113 @@ func (ic *imapConn) selectMailbox(mailbox string, readOnly bool) (*imap.MailboxS
 		}
 
 		// Update tracking
-		ic.currentMbox = mailbox
+		ic.trackSelection(mailbox, readOnly)
 		setCurrentMailboxStatus(status)
 
-		slog.Debug("Selected mailbox", "mailbox", mailbox, "messages", status.Messages, "unseen", status.Unseen)
+		slog.Debug("Selected mailbox", "mailbox", mailbox, "read_only", readOnly, "messages", status.Messages, "unseen", status.Unseen)
 		return nil
 	})
 
 	return status, err
 }
 
-// close properly closes the connection and stops IDLE
+// trackSelection records a completed SELECT of mailbox (ic.mu must be held)
+func (ic *imapConn) trackSelection(mailbox string, readOnly bool) {
+	ic.currentMbox = mailbox
+	ic.readOnly = readOnly
+	ic.selectedAt = time.Now()
+	ic.selectStale = false
+}
+
+// selectionStale reports whether the current selection must be refreshed with a real SELECT
+// even though the mailbox matches: after IDLE ended (unless `imap.reselect_after_idle` is
+// false) or once it is older than `imap.max_selection_age` (ic.mu must be held)
+func (ic *imapConn) selectionStale() bool {
+	if ic.selectStale && (!viper.IsSet("imap.reselect_after_idle") || viper.GetBool("imap.reselect_after_idle")) {
+		return true
+	}
+	maxAge := viper.GetDuration("imap.max_selection_age")
+	return maxAge > 0 && time.Since(ic.selectedAt) > maxAge
+}
+
+// refreshStatus sends a NOOP and re-selects the current mailbox read-write, so the cached
+// mailbox status reflects the messages processing has just changed before IDLE resumes
+func (ic *imapConn) refreshStatus() error {
+	mailbox := ic.currentMbox
+	if mailbox == "" {
+		mailbox = sourceMailbox
+	}
+
+	return ic.withConn(func(c *client.Client) error {
+		if err := c.Noop(); err != nil {
+			return fmt.Errorf("NOOP failed: %w", err)
+		}
+		status, err := c.Select(mailbox, false)
+		if err != nil {
+			return fmt.Errorf("failed to re-select %s: %w", mailbox, err)
+		}
+
+		ic.trackSelection(mailbox, false)
+		setCurrentMailboxStatus(status)
+		slog.Debug("Refreshed mailbox status after processing", "mailbox", mailbox, "messages", status.Messages, "unseen", status.Unseen)
+		return nil
+	})
+}
+
+// reconnectReason reports why the connection should be recycled, or "" if it looks healthy
+func (ic *imapConn) reconnectReason() string {
+	if isConnectionClosed(ic.c) {
+		return "connection closed by server"
+	}
+	if limit := viper.GetInt("serve.reconnect_after_empty"); limit > 0 && ic.blindPolls >= limit {
+		return fmt.Sprintf("%d consecutive empty searches despite unseen messages", ic.blindPolls)
+	}
+	if limit := viper.GetInt("imap.search_timeout_reconnect"); limit > 0 && ic.searchTimeouts >= limit {
+		return fmt.Sprintf("%d consecutive search timeouts", ic.searchTimeouts)
+	}
+	return ""
+}
+
+// recordSearch counts consecutive UID search timeouts for imap.search_timeout_reconnect.
+// Repeated timeouts while SELECT still works indicate a wedged connection, but only count
+// while the server reports unseen mail: without any, there's nothing the search could miss.
+func (ic *imapConn) recordSearch(err error) {
+	if err == nil {
+		ic.searchTimeouts = 0
+		return
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		return
+	}
+	status := getCurrentMailboxStatus()
+	if status == nil || status.Unseen == 0 {
+		slog.Warn("UID search timed out, not counted as the mailbox reports no unseen mail")
+		return
+	}
+	ic.searchTimeouts++
+	slog.Warn("UID search timed out", "mailbox_unseen", status.Unseen, "consecutive_timeouts", ic.searchTimeouts)
+}
+
+// close properly closes the connection and stops IDLE. Closing twice is a no-op, and IDLE
+// can't be restarted once closing has begun.
 func (ic *imapConn) close() error {
-	ic.stopIdle()
+	ic.mu.Lock()
+	if ic.closed {
+		ic.mu.Unlock()
+		return nil
+	}
+	ic.closed = true
+	ic.mu.Unlock()
+
+	recordDisconnect()
+	stopped := ic.stopIdle()
 	ic.mu.Lock()
 	defer ic.mu.Unlock()
+	if !stopped {
+		// LOGOUT would be written while IDLE is still running on the connection
+		slog.Warn("IDLE did not stop, closing the connection without logging out")
+		return ic.c.Terminate()
+	}
 	return ic.c.Logout()
 }
 
@@ -162,15 +295,30 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	Data        []byte
+	Headers     map[string][]string // Content-ID, Content-Description and X- headers of the part
+}
+
+// InlineImage is an embedded part of an HTML mail, referenced from the HTML via `cid:` URLs
+type InlineImage struct {
+	ContentID   string // without angle brackets, may be empty for inline parts without one
+	Filename    string
+	ContentType string
+	Data        []byte
 }
 
 // MailSummary contains basic info about a matching message
 type MailSummary struct {
-	Envelope    *imap.Envelope
-	UID         uint32
-	TextBody    string
-	HTMLBody    string
-	Attachments []Attachment
+	Envelope     *imap.Envelope
+	UID          uint32
+	InternalDate time.Time
+	Headers      message.Header // top-level headers of the original message
+	TextBody     string
+	HTMLBody     string
+	Attachments  []Attachment
+	InlineImages []InlineImage // embedded images re-embedded with their Content-ID
+	Raw          []byte        // original message bytes, only kept for pass-through forwarding
+	Encrypted    bool          // the message is PGP/MIME encrypted (multipart/encrypted)
+	MatchedBy    string        // the filter.from entry that matched the sender
 }
 
 // uidSearchWithTimeout performs an IMAP UID search operation with a timeout
@@ -189,13 +337,26 @@ func uidSearchWithTimeout(client *client.Client, criteria *imap.SearchCriteria,
 
 	select {
 	case result := <-resultCh:
-		return result.uids, result.err
+		if result.err != nil {
+			return nil, result.err
+		}
+		return uniqueUIDs(result.uids), nil
 	case <-time.After(timeout):
 		slog.Warn("IMAP UID search operation timed out", "timeout", timeout)
 		return nil, fmt.Errorf("IMAP UID search timed out after %v", timeout)
 	}
 }
 
+// uniqueUIDs sorts and de-duplicates UIDs, as some buggy servers return the same UID
+// several times in a search, which would otherwise cause duplicate forwards
+func uniqueUIDs(uids []uint32) []uint32 {
+	unique := slices.Compact(slices.Sorted(slices.Values(uids)))
+	if len(unique) != len(uids) {
+		slog.Warn("Server returned duplicate UIDs, ignoring duplicates", "returned", len(uids), "unique", len(unique))
+	}
+	return unique
+}
+
 // isProblematicUID checks if a UID has failed too many times and should be skipped
 func isProblematicUID(uid uint32) bool {
 	probMu.Lock()
@@ -242,38 +403,41 @@ func getCurrentMailboxStatus() *imap.MailboxStatus {
 	return currentMailboxStatus
 }
 
-// FetchMatchingMails connects to the IMAP server and returns mails matching the configured "from" filter.
-func FetchMatchingMails() ([]MailSummary, *client.Client, error) {
+// FetchMatchingMails connects to the IMAP server and returns mails matching the configured "from" filter,
+// and the UIDs of messages left pending because they couldn't be fetched (see fetchMessagesRobustly).
+func FetchMatchingMails() ([]MailSummary, []uint32, *client.Client, error) {
 	client, err := connectAndLogin()
 	if err != nil {
 		slog.Error("IMAP login failed", "error", err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	defer func() {
+	mailSummary, pending, err := FetchMatchingMailsWithClient(client)
+	if err != nil {
 		_ = client.Logout()
 
 		slog.Info("Logged out from IMAP server")
-	}()
-
-	mailSummary, err := FetchMatchingMailsWithClient(client)
+		return nil, nil, nil, err
+	}
 
-	return mailSummary, client, err
+	// The caller keeps using the connection (save to Sent, mark as seen) and logs out when done
+	return mailSummary, pending, client, nil
 }
 
 // FetchMatchingMailsWithClient uses an existing IMAP client to fetch mails matching the configured "from" filter.
-func FetchMatchingMailsWithClient(client *client.Client) ([]MailSummary, error) {
+// It also returns the UIDs left pending (see fetchMessagesRobustly).
+func FetchMatchingMailsWithClient(client *client.Client) ([]MailSummary, []uint32, error) {
 	slog.Info("Searching for matching mails")
 
-	messages, err := fetchMatchingMessages(client)
+	messages, pending, err := fetchMatchingMessages(client)
 	if err != nil {
 		slog.Error("Failed to fetch matching messages", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	slog.Info("Fetched messages", "count", len(messages))
+	slog.Info("Fetched messages", "count", len(messages), "pending", len(pending))
 
-	return messages, nil
+	return messages, pending, nil
 }
 
 // FetchMatchingMailsWithConn uses the imapConn wrapper to fetch mails matching the configured "from" filter.
@@ -306,7 +470,7 @@ func fetchMatchingMessagesWithConn(imapConn *imapConn) ([]MailSummary, error) {
 	slog.Debug("Email filter configuration", "original_emails", filterFroms, "normalized_emails", normalizedFilters)
 
 	// Use selectMailbox to properly manage INBOX selection with tracking
-	_, err := imapConn.selectMailbox("INBOX", false) // false = read-write
+	_, err := imapConn.selectMailbox("INBOX", searchReadOnly())
 	if err != nil {
 		return nil, fmt.Errorf("failed to select INBOX: %w", err)
 	}
@@ -324,6 +488,7 @@ func fetchMatchingMessagesWithConn(imapConn *imapConn) ([]MailSummary, error) {
 		uids, err = uidSearchWithTimeout(client, criteria, defaultIMAPTimeout)
 		return err
 	})
+	imapConn.recordSearch(err)
 	if err != nil {
 		slog.Error("UID search failed", "error", err)
 		return nil, fmt.Errorf("failed to search: %w", err)
@@ -333,17 +498,38 @@ func fetchMatchingMessagesWithConn(imapConn *imapConn) ([]MailSummary, error) {
 
 	// No unread messages found
 	if len(uids) == 0 {
+		// A search that finds nothing while the server reports unseen mail suggests a "connected but blind" session
+		if status := getCurrentMailboxStatus(); status != nil && status.Unseen > 0 {
+			imapConn.blindPolls++
+			slog.Warn("Search found no unread messages but mailbox reports unseen mail",
+				"mailbox_unseen", status.Unseen,
+				"consecutive_empty", imapConn.blindPolls)
+		} else {
+			imapConn.blindPolls = 0
+		}
+
 		slog.Info("No unread messages found")
 		return nil, nil
 	}
 
+	imapConn.blindPolls = 0
+
+	// Only react to mail that arrived after the startup baseline, if one is set
+	if imapConn.baselineUID > 0 {
+		uids = imapConn.aboveBaseline(uids)
+		if len(uids) == 0 {
+			slog.Info("No new unread messages since startup")
+			return nil, nil
+		}
+	}
+
 	slog.Debug("Found unread messages", "count", len(uids))
 
 	// Use robust approach to handle invalid or stale UIDs
 	var messages []MailSummary
 	err = imapConn.withConn(func(client *client.Client) error {
 		var err error
-		messages, err = fetchMessagesRobustly(client, uids, normalizedFilters)
+		messages, _, err = fetchMessagesRobustly(client, uids, normalizedFilters)
 		return err
 	})
 	if err != nil {
@@ -353,10 +539,110 @@ func fetchMatchingMessagesWithConn(imapConn *imapConn) ([]MailSummary, error) {
 	return messages, nil
 }
 
+// searchReadOnly reports whether searches and fetches run in a read-only EXAMINE of the
+// INBOX (`imap.separate_search_examine`), for servers that misbehave when searching a
+// read-write selection. The INBOX is then selected read-write again before flags change.
+func searchReadOnly() bool {
+	return viper.GetBool("imap.separate_search_examine")
+}
+
 // connectAndLogin establishes a secure connection to the IMAP server with connection-level timeouts,
 // logs in using the configured credentials, and selects the INBOX.
 // Returns an authenticated IMAP client, or an error if connection or login fails.
+// The number of concurrent connections per server is limited by `imap.max_connections`.
 func connectAndLogin() (*client.Client, error) {
+	server := viper.GetString("imap.server")
+
+	release, err := acquireConnSlot(server)
+	if err != nil {
+		return nil, err
+	}
+
+	imapClient, err := dialAndLogin()
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// Free the slot once the connection is logged out or dropped
+	go func() {
+		<-imapClient.LoggedOut()
+		release()
+	}()
+
+	return imapClient, nil
+}
+
+// newIMAPClient sets up the IMAP session on conn according to `imap.security`: implicit TLS
+// ("ssl", the default), an upgrade with STARTTLS ("starttls" or "tls") or no encryption ("none")
+func newIMAPClient(conn net.Conn, security string, tlsConfig *tls.Config) (*client.Client, error) {
+	switch security {
+	case "starttls", "tls":
+		imapClient, err := client.New(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IMAP client: %w", err)
+		}
+		// Never fall back to plaintext when the upgrade isn't offered
+		if ok, err := imapClient.SupportStartTLS(); err != nil || !ok {
+			return nil, fmt.Errorf("IMAP server does not offer STARTTLS (imap.security: %s)", security)
+		}
+		if err := imapClient.StartTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+		return imapClient, nil
+	case "none":
+		slog.Warn("IMAP connection is NOT encrypted (imap.security: none), credentials and mail are sent in plaintext")
+		imapClient, err := client.New(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IMAP client: %w", err)
+		}
+		return imapClient, nil
+	default:
+		tlsConn := tls.Client(conn, tlsConfig)
+
+		// Perform TLS handshake with timeout protection
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+
+		// Create IMAP client from the TLS connection
+		imapClient, err := client.New(tlsConn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IMAP client: %w", err)
+		}
+		return imapClient, nil
+	}
+}
+
+// dialAndLogin opens the connection as configured by `imap.security`, logs in and selects the
+// INBOX (see connectAndLogin)
+func dialAndLogin() (*client.Client, error) {
+	imapClient, err := dialAndAuthenticate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Select the "INBOX" mailbox in read-write mode (false = not read-only)
+	mailboxStatus, err := imapClient.Select("INBOX", false) // false = read-write
+	if err != nil {
+		_ = imapClient.Logout()
+		return nil, fmt.Errorf("failed to select INBOX: %w", err)
+	}
+
+	slog.Debug("Connected to IMAP and selected INBOX in read-write mode",
+		"messages", mailboxStatus.Messages,
+		"recent", mailboxStatus.Recent,
+		"unseen", mailboxStatus.Unseen)
+
+	// Store mailbox status for use in search
+	setCurrentMailboxStatus(mailboxStatus)
+
+	return imapClient, nil
+}
+
+// dialAndAuthenticate opens the connection as configured by `imap.security` and logs in,
+// without selecting a mailbox
+func dialAndAuthenticate() (*client.Client, error) {
 	// Load connection parameters from config
 	server := viper.GetString("imap.server")
 	port := viper.GetInt("imap.port")
@@ -396,30 +682,26 @@ func connectAndLogin() (*client.Client, error) {
 	deadline := time.Now().Add(30 * time.Second)
 	_ = conn.SetDeadline(deadline)
 
-	// Wrap connection with TLS
-	tlsConfig := &tls.Config{
+	tlsConfig := withCertExpiryCheck(&tls.Config{
 		ServerName: server, // ensures correct certificate validation
-	}
+	}, "imap")
 
-	tlsConn := tls.Client(conn, tlsConfig)
-
-	// Perform TLS handshake with timeout protection
-	if err := tlsConn.Handshake(); err != nil {
+	imapClient, err := newIMAPClient(conn, viper.GetString("imap.security"), tlsConfig)
+	if err != nil {
 		_ = conn.Close()
-		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		return nil, err
 	}
 	// Clear deadline after successful handshake
-	_ = tlsConn.SetDeadline(time.Time{})
-
-	// Create IMAP client from the TLS connection
-	imapClient, err := client.New(tlsConn)
-	if err != nil {
-		_ = tlsConn.Close()
-		return nil, fmt.Errorf("failed to create IMAP client: %w", err)
-	}
+	_ = conn.SetDeadline(time.Time{})
 
 	slog.Debug("IMAP client created, setting connection timeouts")
 
+	// Optionally log raw protocol traffic (credentials are redacted) for diagnosing server quirks
+	if viper.GetBool("imap.debug_wire") {
+		slog.Debug("IMAP wire logging enabled")
+		imapClient.SetDebug(newWireLogger())
+	}
+
 	// Check connection health before proceeding
 	if err := checkConnectionHealth(imapClient); err != nil {
 		_ = imapClient.Logout()
@@ -427,32 +709,55 @@ func connectAndLogin() (*client.Client, error) {
 	}
 
 	// Attempt to log in with the provided credentials
-	if err := imapClient.Login(username, password); err != nil {
+	if err := imapLogin(imapClient, username, password); err != nil {
 		_ = imapClient.Logout() // clean up if login fails
 		return nil, fmt.Errorf("failed to login: %w", err)
 	}
 
-	// Select the "INBOX" mailbox in read-write mode (false = not read-only)
-	mailboxStatus, err := imapClient.Select("INBOX", false) // false = read-write
-	if err != nil {
-		_ = imapClient.Logout()
-		return nil, fmt.Errorf("failed to select INBOX: %w", err)
+	return imapClient, nil
+}
+
+// imapLogin authenticates with XOAUTH2 if configured (`imap.auth`). Otherwise it logs in with
+// LOGIN, or with SASL PLAIN when the server forbids LOGIN by advertising LOGINDISABLED.
+// Without an encrypted connection or AUTH=PLAIN it fails with an explanation instead of the
+// library's generic error.
+func imapLogin(imapClient *client.Client, username, password string) error {
+	if imapAuthMethod() == imapAuthXOAuth2 {
+		token, err := xoauth2Token()
+		if err != nil {
+			return err
+		}
+		if ok, err := imapClient.SupportAuth("XOAUTH2"); err != nil || !ok {
+			return errors.New("the server doesn't offer AUTH=XOAUTH2 (imap.auth: xoauth2)")
+		}
+		return imapClient.Authenticate(newXOAuth2Client(username, token))
 	}
 
-	slog.Debug("Connected to IMAP and selected INBOX in read-write mode",
-		"messages", mailboxStatus.Messages,
-		"recent", mailboxStatus.Recent,
-		"unseen", mailboxStatus.Unseen)
+	disabled, err := imapClient.Support("LOGINDISABLED")
+	if err != nil {
+		return fmt.Errorf("failed to read server capabilities: %w", err)
+	}
+	if !disabled {
+		return imapClient.Login(username, password)
+	}
 
-	// Store mailbox status for use in search
-	setCurrentMailboxStatus(mailboxStatus)
+	if !imapClient.IsTLS() {
+		return errors.New("the server refuses to log in over an unencrypted connection (LOGINDISABLED), " +
+			"set imap.security to ssl or starttls")
+	}
+	if ok, err := imapClient.SupportAuth(sasl.Plain); err != nil || !ok {
+		return errors.New("the server disabled LOGIN (LOGINDISABLED) and doesn't offer AUTH=PLAIN, " +
+			"no supported authentication method is available")
+	}
 
-	return imapClient, nil
+	slog.Debug("Server disabled LOGIN, authenticating with SASL PLAIN")
+	return imapClient.Authenticate(sasl.NewPlainClient("", username, password))
 }
 
 // fetchMatchingMessages searches the INBOX for messages from the configured "filter.from" address,
 // fetches basic message data (envelope, UID, body), parses the MIME structure, and returns a list of summaries.
-func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
+// It also returns the UIDs left pending (see fetchMessagesRobustly).
+func fetchMatchingMessages(client *client.Client) ([]MailSummary, []uint32, error) {
 	// Load the sender filter (e.g., "vorstand@example.com") from config
 	filterFroms := viper.GetStringSlice("filter.from")
 
@@ -487,7 +792,7 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 	selectErr := make(chan error, 1)
 
 	go func() {
-		status, err := client.Select("INBOX", false) // false = read-write
+		status, err := client.Select("INBOX", searchReadOnly())
 		if err != nil {
 			selectErr <- err
 		} else {
@@ -501,14 +806,20 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 		slog.Debug("INBOX selected successfully", "messages", mailboxStatus.Messages, "unseen", mailboxStatus.Unseen)
 	case err := <-selectErr:
 		slog.Error("Failed to select INBOX before search", "error", err)
-		return nil, fmt.Errorf("failed to select INBOX: %w", err)
+		return nil, nil, fmt.Errorf("failed to select INBOX: %w", err)
 	case <-time.After(10 * time.Second):
 		slog.Error("INBOX select operation timed out")
-		return nil, fmt.Errorf("INBOX select timed out after 10s")
+		return nil, nil, fmt.Errorf("INBOX select timed out after 10s")
 	}
 
 	// Update cached status
 	setCurrentMailboxStatus(mailboxStatus)
+
+	// Optionally search above the previous run's high-water mark instead of by the \Seen flag
+	var mark uint32
+	if store := highWaterMarkStore(); store != nil {
+		criteria, mark = highWaterMarkCriteria(store, mailboxStatus)
+	}
 	slog.Debug("About to start UID search")
 
 	slog.Debug("Starting UID search")
@@ -516,7 +827,10 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 	uids, err := uidSearchWithTimeout(client, criteria, defaultIMAPTimeout)
 	if err != nil {
 		slog.Error("UID search failed", "error", err)
-		return nil, fmt.Errorf("failed to search: %w", err)
+		return nil, nil, fmt.Errorf("failed to search: %w", err)
+	}
+	if mark > 0 {
+		uids = aboveHighWaterMark(uids, mark)
 	}
 
 	slog.Debug("UID search completed successfully")
@@ -528,7 +842,7 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 	}
 
 	// Validate search results against mailbox status
-	if status := getCurrentMailboxStatus(); status != nil && len(uids) > 0 && status.Unseen == 0 {
+	if status := getCurrentMailboxStatus(); status != nil && criteria.Uid == nil && len(uids) > 0 && status.Unseen == 0 {
 		slog.Warn("Search/status inconsistency detected",
 			"search_found", len(uids),
 			"mailbox_unseen", status.Unseen,
@@ -539,7 +853,7 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 	// No unread messages found
 	if len(uids) == 0 {
 		slog.Info("No unread messages found")
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	slog.Debug("Found unread messages", "count", len(uids))
@@ -548,21 +862,24 @@ func fetchMatchingMessages(client *client.Client) ([]MailSummary, error) {
 	// UIDs returned by search may be invalid/stale due to concurrent mailbox changes or server inconsistencies
 	// Phase 1: Validate UIDs by fetching just envelopes
 	slog.Debug("Starting robust message fetch", "uid_count", len(uids))
-	messages, err := fetchMessagesRobustly(client, uids, normalizedFilters)
+	messages, pending, err := fetchMessagesRobustly(client, uids, normalizedFilters)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return messages, nil
+	return messages, pending, nil
 }
 
-// fetchMessagesRobustly implements a two-phase fetch approach to handle problematic UIDs
-func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []string) ([]MailSummary, error) {
+// fetchMessagesRobustly implements a two-phase fetch approach to handle problematic UIDs. Besides
+// the matching messages it returns the UIDs left pending: messages that failed to fetch, were
+// skipped as problematic or are still being delivered. They weren't processed and must be
+// searched for again, so the high-water mark must not move past them.
+func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []string) ([]MailSummary, []uint32, error) {
 	slog.Debug("Entered fetchMessagesRobustly", "uids", uids, "count", len(uids))
 
 	if len(uids) == 0 {
 		slog.Debug("No UIDs to process, returning empty results")
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Phase 1: Validate all UIDs by fetching just envelopes
@@ -570,13 +887,14 @@ func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []strin
 	validUIDs, err := validateUIDs(client, uids)
 	if err != nil {
 		slog.Error("UID validation failed", "error", err)
-		return nil, fmt.Errorf("UID validation failed: %w", err)
+		return nil, nil, fmt.Errorf("UID validation failed: %w", err)
 	}
+	validUIDs = uniqueUIDs(validUIDs)
 	slog.Debug("UID validation completed", "valid_count", len(validUIDs))
 
 	if len(validUIDs) == 0 {
 		slog.Info("No valid UIDs found")
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	slog.Debug("UID validation complete", "valid_uids", validUIDs, "valid_count", len(validUIDs), "original_count", len(uids))
@@ -588,21 +906,42 @@ func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []strin
 	failedUIDs := make([]uint32, 0) // Track failed message fetches
 
 	skippedUIDs := make([]uint32, 0) // Track UIDs skipped due to being problematic
+	var deliveringUIDs []uint32      // UIDs still being delivered, see confirmComplete
 
 	for _, uid := range validUIDs {
 		// Skip UIDs that have failed too many times
 		if isProblematicUID(uid) {
 			skippedUIDs = append(skippedUIDs, uid)
+			metrics.MessagesSkippedProblematic.Inc()
 			slog.Info("Skipping problematic UID that has failed repeatedly", "uid", uid)
 			continue
 		}
 
 		// Fetch individual message
 		mailSummary, matches, err := fetchSingleMessage(client, uid, filters)
+		if errors.Is(err, errStillDelivering) {
+			// Not a failure of the message, it is fetched again by the next run
+			slog.Info("Message is still being delivered, leaving it for the next run", "uid", uid, "error", err)
+			deliveringUIDs = append(deliveringUIDs, uid)
+			continue
+		}
 		if err != nil {
-			failedUIDs = append(failedUIDs, uid)
 			recordUIDFailure(uid) // Track the failure
 
+			// A message that repeatedly can't be parsed is handled by `forward.on_parse_failure`
+			// rather than being dropped silently
+			var pe *parseError
+			if errors.As(err, &pe) && isProblematicUID(uid) {
+				if fallback := handleParseFailure(pe); fallback != nil {
+					metrics.MessagesMatched.Inc()
+					matchingUIDs = append(matchingUIDs, uid)
+					results = append(results, *fallback)
+					continue
+				}
+			}
+			failedUIDs = append(failedUIDs, uid)
+			metrics.MessagesFailed.Inc()
+
 			if strings.Contains(err.Error(), "timed out") {
 				slog.Warn("Message fetch timed out, skipping problematic message", "uid", uid, "error", err)
 			} else {
@@ -613,8 +952,16 @@ func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []strin
 
 		// Clear from problematic list if it succeeded
 		clearProblematicUID(uid)
+		metrics.MessagesFetched.Inc()
+
+		// Attachment names are only known once the body is parsed
+		if matches && !hasMatchingAttachment(*mailSummary) {
+			slog.Debug("No attachment matches filter.attachment_name", "uid", uid)
+			matches = false
+		}
 
 		if matches {
+			metrics.MessagesMatched.Inc()
 			matchingUIDs = append(matchingUIDs, uid)
 			results = append(results, *mailSummary)
 			slog.Debug("Successfully processed matching message", "uid", uid)
@@ -648,7 +995,8 @@ func fetchMessagesRobustly(client *client.Client, uids []uint32, filters []strin
 
 	slog.Debug("Robust fetch complete", "total_results", len(results), "matching", len(matchingUIDs), "non_matching", len(nonMatchingUIDs), "failed", len(failedUIDs))
 
-	return results, nil
+	pending := slices.Concat(failedUIDs, skippedUIDs, deliveringUIDs)
+	return results, pending, nil
 }
 
 // validateUIDs checks if UIDs are valid by fetching just envelope data
@@ -702,11 +1050,39 @@ func validateUIDs(client *client.Client, uids []uint32) ([]uint32, error) {
 func fetchSingleMessage(client *client.Client, uid uint32, filters []string) (*MailSummary, bool, error) {
 	slog.Debug("Fetching individual message with UID", "requested_uid", uid)
 
+	// Optionally decide on the match from the real headers before downloading the full message
+	headerOnly := viper.GetBool("search.header_only_filter")
+	if headerOnly {
+		matches, err := matchHeaderFields(client, uid, filters)
+		if err != nil {
+			return nil, false, err
+		}
+		if !matches {
+			return nil, false, nil
+		}
+	}
+
+	// Optionally make sure the server has received the whole message before downloading it
+	if err := confirmComplete(client, uid, filters, headerOnly); err != nil {
+		return nil, false, err
+	}
+
+	// Check the size before downloading the body, so a giant message can't exhaust memory
+	if limit := maxMessageBytes(); limit > 0 {
+		summary, handled, err := guardMessageSize(client, uid, filters, headerOnly, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		if handled {
+			return summary, summary != nil, nil
+		}
+	}
+
 	seqset := new(imap.SeqSet)
 	seqset.AddNum(uid)
 
 	section := &imap.BodySectionName{Peek: true} // BODY.PEEK[] to avoid marking as read
-	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, section.FetchItem()}
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}
 
 	messages := make(chan *imap.Message, 1)
 	errCh := make(chan error, 1)
@@ -717,12 +1093,14 @@ func fetchSingleMessage(client *client.Client, uid uint32, filters []string) (*M
 	// Read the message (and its body) while the fetch is in flight
 	timeout := 30 * time.Second
 	var msg *imap.Message
+	fetchDone := false // whether the fetch result was already received
 	select {
 	case msg = <-messages:
 		if msg == nil {
 			return nil, false, fmt.Errorf("no message received for UID %d", uid)
 		}
 	case err := <-errCh: // server replied quickly but no message?
+		fetchDone = true
 		if err != nil {
 			return nil, false, fmt.Errorf("failed to fetch message %d: %w", uid, err)
 		}
@@ -739,8 +1117,16 @@ func fetchSingleMessage(client *client.Client, uid uint32, filters []string) (*M
 		return nil, false, fmt.Errorf("IMAP UID fetch timed out after %v", timeout)
 	}
 
-	// Filter
-	matches := isFromAddressMatching(msg.Envelope, filters)
+	// The literal is already read into memory, so wait for the fetch to complete: the next
+	// command must not start while it is still running
+	if !fetchDone {
+		if err := waitForFetch(errCh, uid, timeout); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Filter (already decided from the headers in header-only mode)
+	matches := headerOnly || isMessageMatching(msg.Envelope, filters)
 	if !matches {
 		slog.Debug("Message does not match filter", "uid", uid, "from", getFromAddress(msg.Envelope))
 		// drain/allow the command to complete
@@ -755,34 +1141,116 @@ func fetchSingleMessage(client *client.Client, uid uint32, filters []string) (*M
 	// IMPORTANT: read the body to keep the parser unblocked
 	body := msg.GetBody(section)
 	if body == nil {
-		return nil, true, fmt.Errorf("no body found for message %d", uid)
+		// The server sent no body literal at all: a fetch problem, retried on the next run
+		return nil, true, fmt.Errorf("server returned no body for message %d", uid)
 	}
 	// Ensure body is always drained to prevent wedging the parser
 	defer func() { _, _ = io.Copy(io.Discard, body) }()
 
-	entity, err := message.Read(body) // this consumes the literal stream
+	// An empty literal is a valid (if unusual) message; forward it with an empty body
+	// based on the envelope instead of failing to parse it
+	if body.Len() == 0 {
+		slog.Warn("Message has an empty body, forwarding envelope only", "uid", uid)
+		return &MailSummary{
+			Envelope:     msg.Envelope,
+			UID:          msg.Uid,
+			InternalDate: msg.InternalDate,
+			MatchedBy:    matchedFilter(getFromAddress(msg.Envelope), filters),
+		}, true, nil
+	}
+
+	// The header is read first, recording the bytes, to decide whether to keep a raw copy
+	rec := &recordingReader{r: body}
+	br := bufio.NewReader(rec)
+	fields, headerErr := textproto.ReadHeader(br)
+	rec.stopped = true
+	header := message.Header{Header: fields}
+
+	// Pass-through forwarding resends the original bytes, so keep a copy of them. They are
+	// also needed to forward messages that can't be parsed as they are, and encrypted
+	// messages, which are recognized by their header so others aren't copied just in case.
+	var raw []byte
+	keepRaw := forwardMode() == forwardModePassthrough
+	encrypted := headerErr == nil && isEncrypted(header)
+	if keepRaw || parseFailurePolicy() == parseFailureForwardRaw || (encrypted && encryptedPolicy() == encryptedPassthrough) {
+		consumed := rec.buf.Bytes()[:rec.buf.Len()-br.Buffered()]
+		rest, err := io.ReadAll(br)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read message %d: %w", uid, err)
+		}
+		raw = append(consumed, rest...)
+		br = bufio.NewReader(bytes.NewReader(rest))
+	}
+
+	err := headerErr
+	var entity *message.Entity
+	if err == nil {
+		entity, err = message.New(header, br) // this consumes the literal stream
+	}
+	if isUnknownCharset(err) {
+		slog.Debug("Unknown charset in message, keeping the body unconverted", "uid", uid, "error", err)
+		err = nil
+	}
 	if err != nil {
-		return nil, true, fmt.Errorf("failed to parse message %d: %w", uid, err)
+		return nil, true, &parseError{
+			summary: MailSummary{
+				Envelope:     msg.Envelope,
+				UID:          msg.Uid,
+				InternalDate: msg.InternalDate,
+				Raw:          raw,
+				MatchedBy:    matchedFilter(getFromAddress(msg.Envelope), filters),
+			},
+			err: err,
+		}
 	}
+	if !keepRaw && !encrypted {
+		raw = nil
+	}
+
+	text, html, attachments, inlineImages := extractBodies(entity)
+
+	return &MailSummary{
+		Envelope:     msg.Envelope,
+		UID:          msg.Uid,
+		InternalDate: msg.InternalDate,
+		Headers:      entity.Header,
+		TextBody:     text,
+		HTMLBody:     html,
+		Attachments:  attachments,
+		InlineImages: inlineImages,
+		Encrypted:    encrypted,
+		Raw:          raw,
+		MatchedBy:    matchedFilter(getFromAddress(msg.Envelope), filters),
+	}, true, nil
+}
 
-	text, html, attachments := extractBodies(entity)
+// recordingReader records what is read through it until stopped
+type recordingReader struct {
+	r       io.Reader
+	buf     bytes.Buffer
+	stopped bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if !r.stopped {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
 
-	// Optionally wait for the fetch to fully finish (so parser drains)
+// waitForFetch waits for the UID FETCH of a message to complete after its data was received,
+// so no other command is sent while it is still running, and returns its error
+func waitForFetch(errCh <-chan error, uid uint32, timeout time.Duration) error {
 	select {
 	case err := <-errCh:
 		if err != nil {
-			slog.Warn("Fetch finished with error after body read", "uid", uid, "err", err)
+			return fmt.Errorf("failed to fetch message %d: %w", uid, err)
 		}
-	default:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out waiting for fetch of message %d to complete", uid)
 	}
-
-	return &MailSummary{
-		Envelope:    msg.Envelope,
-		UID:         msg.Uid,
-		TextBody:    text,
-		HTMLBody:    html,
-		Attachments: attachments,
-	}, true, nil
 }
 
 // logNonMatchingMessages logs details about non-matching messages for debugging
@@ -855,9 +1323,91 @@ func isFromAddressMatching(envelope *imap.Envelope, normalizedFilters []string)
 		return false
 	}
 
-	fromAddress := strings.ToLower(envelope.From[0].Address())
+	return isAddressMatching(envelope.From[0].Address(), normalizedFilters)
+}
+
+// hasMatchingAttachment reports whether mail carries an attachment (or inline image) whose
+// name matches one of the `filter.attachment_name` patterns, if any are configured
+func hasMatchingAttachment(mail MailSummary) bool {
+	patterns := viper.GetStringSlice("filter.attachment_name")
+	if len(patterns) == 0 {
+		return true
+	}
+
+	names := make([]string, 0, len(mail.Attachments)+len(mail.InlineImages))
+	for _, att := range mail.Attachments {
+		names = append(names, att.Filename)
+	}
+	for _, img := range mail.InlineImages {
+		names = append(names, img.Filename)
+	}
+	return matchAttachmentNames(names, patterns)
+}
+
+// isSubjectMatching checks if the message's subject matches any of the `filter.subject` patterns.
+// Without patterns every message matches; with patterns, a message without subject never does.
+func isSubjectMatching(envelope *imap.Envelope, patterns []string) bool {
+	subject := ""
+	if envelope != nil {
+		subject = envelope.Subject
+	}
+	return matchSubject(subject, patterns)
+}
+
+// isMessageMatching applies the sender and subject filters to a message's envelope. When both
+// `filter.from` and `filter.subject` are set a message must satisfy both, otherwise only the
+// configured one applies.
+func isMessageMatching(envelope *imap.Envelope, normalizedFilters []string) bool {
+	from := ""
+	if envelope != nil && len(envelope.From) > 0 && envelope.From[0] != nil {
+		from = envelope.From[0].Address()
+	}
+	subjectPatterns := viper.GetStringSlice("filter.subject")
+	return isSenderMatching(from, normalizedFilters, len(subjectPatterns) > 0) &&
+		isSubjectMatching(envelope, subjectPatterns)
+}
+
+// isSenderMatching applies the sender filter. Without `filter.from` entries every sender is
+// accepted if a subject filter is set, and none otherwise; `filter.exclude_domains` always applies.
+func isSenderMatching(from string, normalizedFilters []string, hasSubjectFilter bool) bool {
+	if len(normalizedFilters) > 0 {
+		return isAddressMatching(from, normalizedFilters)
+	}
+	return hasSubjectFilter && !isExcludedDomain(from)
+}
+
+// isAddressMatching checks if a sender address matches the filter criteria,
+// honoring `*` wildcards and `!` negations (see patternMatcher)
+func isAddressMatching(address string, normalizedFilters []string) bool {
+	if isExcludedDomain(address) {
+		return false
+	}
+	return newPatternMatcher(normalizedFilters).Match(address)
+}
+
+// isExcludedDomain reports whether the sender's domain is listed in `filter.exclude_domains`.
+// Entries may use `*` wildcards (e.g. `*.example.org`); excluded senders are never forwarded.
+func isExcludedDomain(address string) bool {
+	excluded := viper.GetStringSlice("filter.exclude_domains")
+	if len(excluded) == 0 {
+		return false
+	}
+
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok || !newPatternMatcher(excluded).Match(domain) {
+		return false
+	}
+
+	if viper.GetBool("verbose") {
+		slog.Info("Sender domain is excluded from forwarding", "from", address, "domain", domain)
+	}
+	return true
+}
 
-	return slices.Contains(normalizedFilters, fromAddress)
+// matchedFilter returns the filter entry that matched a sender address, or "" if none did
+func matchedFilter(address string, normalizedFilters []string) string {
+	pattern, _ := newPatternMatcher(normalizedFilters).MatchedPattern(address)
+	return pattern
 }
 
 // getFromAddress safely extracts the From address from an envelope
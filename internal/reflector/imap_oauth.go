@@ -0,0 +1,51 @@
+package reflector
+
+import (
+	"errors"
+
+	"github.com/emersion/go-sasl"
+	"github.com/spf13/viper"
+)
+
+// IMAP authentication methods selectable with `imap.auth`
+const (
+	imapAuthPassword = "password" // LOGIN (or SASL PLAIN, see imapLogin) with imap.password (default)
+	imapAuthXOAuth2  = "xoauth2"  // SASL XOAUTH2 with imap.oauth.access_token (Gmail, Office 365)
+)
+
+// imapAuthMethod returns the configured `imap.auth`
+func imapAuthMethod() string {
+	if viper.GetString("imap.auth") == imapAuthXOAuth2 {
+		return imapAuthXOAuth2
+	}
+	return imapAuthPassword
+}
+
+// xoauth2Client implements the SASL XOAUTH2 mechanism, which go-sasl doesn't provide
+type xoauth2Client struct {
+	username, token string
+}
+
+// newXOAuth2Client returns a SASL client authenticating username with an OAuth2 access token
+func newXOAuth2Client(username, token string) sasl.Client {
+	return &xoauth2Client{username: username, token: token}
+}
+
+func (a *xoauth2Client) Start() (string, []byte, error) {
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next answers the server's error challenge (a JSON status) with an empty response, after
+// which the server fails the authentication with its error message
+func (a *xoauth2Client) Next([]byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// xoauth2Token returns the configured `imap.oauth.access_token`
+func xoauth2Token() (string, error) {
+	token := viper.GetString("imap.oauth.access_token")
+	if token == "" {
+		return "", errors.New("imap.auth is xoauth2, but imap.oauth.access_token is empty")
+	}
+	return token, nil
+}
@@ -0,0 +1,454 @@
+package reflector
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/spf13/viper"
+)
+
+// newTestIMAPClient starts an in-memory IMAP server and returns a client logged in with
+// INBOX selected. The memory backend's INBOX holds one message (UID 6, from contact@example.org).
+func newTestIMAPClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	srv := server.New(memory.New())
+	srv.AllowInsecureAuth = true
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	c, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Logout() })
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatalf("failed to select INBOX: %v", err)
+	}
+	return c
+}
+
+func TestUniqueUIDs(t *testing.T) {
+	t.Parallel()
+
+	got := uniqueUIDs([]uint32{7, 3, 7, 1, 3, 3})
+	if want := []uint32{1, 3, 7}; !slices.Equal(got, want) {
+		t.Errorf("uniqueUIDs = %v, want %v", got, want)
+	}
+}
+
+func TestFetchMessagesRobustlyDuplicateUIDs(t *testing.T) {
+	c := newTestIMAPClient(t)
+
+	messages, _, err := fetchMessagesRobustly(c, []uint32{6, 6, 6}, []string{"contact@example.org"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("expected the duplicated UID to be fetched once, got %d messages", len(messages))
+	}
+	if messages[0].UID != 6 || messages[0].TextBody != "Hi there :)" {
+		t.Errorf("unexpected message: uid=%d body=%q", messages[0].UID, messages[0].TextBody)
+	}
+}
+
+func TestFetchMessagesRobustlyPending(t *testing.T) {
+	c := newTestIMAPClient(t)
+
+	for range maxFailuresBeforeSkip {
+		recordUIDFailure(6)
+	}
+	t.Cleanup(func() { clearProblematicUID(6) })
+
+	messages, pending, err := fetchMessagesRobustly(c, []uint32{6}, []string{"contact@example.org"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 0 || !slices.Equal(pending, []uint32{6}) {
+		t.Errorf("a skipped problematic UID should be pending, got %d messages, pending %v", len(messages), pending)
+	}
+}
+
+func TestFetchSingleMessageSizeGuard(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	c := newTestIMAPClient(t)
+	filters := []string{"contact@example.org"}
+
+	viper.Set("fetch.max_message_bytes", 64)
+
+	summary, matches, err := fetchSingleMessage(c, 6, filters)
+	if err != nil || matches || summary != nil {
+		t.Fatalf("oversized message should be skipped, got summary=%v matches=%v err=%v", summary, matches, err)
+	}
+
+	viper.Set("fetch.oversize_policy", "reference")
+
+	summary, matches, err = fetchSingleMessage(c, 6, filters)
+	if err != nil || !matches || summary == nil {
+		t.Fatalf("oversized message should be referenced, got summary=%v matches=%v err=%v", summary, matches, err)
+	}
+	if !strings.Contains(summary.TextBody, "UID 6") || summary.Envelope == nil {
+		t.Errorf("unexpected reference summary: %+v", summary)
+	}
+
+	viper.Set("fetch.max_message_bytes", "1MB")
+
+	summary, matches, err = fetchSingleMessage(c, 6, filters)
+	if err != nil || !matches || summary.TextBody != "Hi there :)" {
+		t.Fatalf("message within the limit should be fetched, got summary=%v matches=%v err=%v", summary, matches, err)
+	}
+}
+
+func TestFetchSingleMessageEmptyBody(t *testing.T) {
+	c := newTestIMAPClient(t)
+	filters := []string{"contact@example.org"}
+
+	raw := "From: contact@example.org\r\nTo: contact@example.org\r\nSubject: Empty\r\n"
+	if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatalf("failed to append message: %v", err)
+	}
+
+	summary, matches, err := fetchSingleMessage(c, 7, filters)
+	if err != nil || !matches || summary == nil {
+		t.Fatalf("message without a body should be forwarded, got summary=%v matches=%v err=%v", summary, matches, err)
+	}
+	if summary.TextBody != "" || summary.HTMLBody != "" || len(summary.Attachments) != 0 {
+		t.Errorf("expected an empty body, got %+v", summary)
+	}
+	if summary.Envelope == nil || summary.Envelope.Subject != "Empty" {
+		t.Errorf("expected the envelope to be kept, got %+v", summary.Envelope)
+	}
+}
+
+// testServerCert returns a self-signed certificate for host and a pool trusting it
+func testServerCert(t *testing.T, host string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestNewIMAPClientSecurity(t *testing.T) {
+	t.Parallel()
+
+	cert, pool := testServerCert(t, "imap.test")
+
+	start := func(serverTLS *tls.Config) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		srv := server.New(memory.New())
+		srv.AllowInsecureAuth = true
+		srv.TLSConfig = serverTLS
+		go func() { _ = srv.Serve(ln) }()
+		t.Cleanup(func() { _ = srv.Close() })
+		return ln.Addr().String()
+	}
+	connect := func(addr, security string) (*client.Client, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		c, err := newIMAPClient(conn, security, &tls.Config{ServerName: "imap.test", RootCAs: pool})
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		t.Cleanup(func() { _ = c.Logout() })
+		return c, nil
+	}
+
+	c, err := connect(start(&tls.Config{Certificates: []tls.Certificate{cert}}), "starttls")
+	if err != nil {
+		t.Fatalf("STARTTLS connection failed: %v", err)
+	}
+	if !c.IsTLS() {
+		t.Error("expected an encrypted connection after STARTTLS")
+	}
+	if err := c.Login("username", "password"); err != nil {
+		t.Errorf("login after STARTTLS failed: %v", err)
+	}
+
+	plainAddr := start(nil)
+	if _, err := connect(plainAddr, "starttls"); err == nil {
+		t.Error("expected an error when the server doesn't offer STARTTLS")
+	}
+
+	c, err = connect(plainAddr, "none")
+	if err != nil {
+		t.Fatalf("plaintext connection failed: %v", err)
+	}
+	if err := c.Login("username", "password"); err != nil {
+		t.Errorf("plaintext login failed: %v", err)
+	}
+}
+
+func TestRefreshStatus(t *testing.T) {
+	t.Cleanup(func() { setCurrentMailboxStatus(nil) })
+
+	conn := newImapConn(newTestIMAPClient(t))
+	setCurrentMailboxStatus(nil)
+
+	if err := conn.refreshStatus(); err != nil {
+		t.Fatal(err)
+	}
+	status := getCurrentMailboxStatus()
+	if status == nil || status.Name != "INBOX" || status.Messages != 1 {
+		t.Fatalf("expected the INBOX status to be refreshed, got %+v", status)
+	}
+	if conn.currentMbox != "INBOX" {
+		t.Errorf("expected INBOX to be tracked as selected, got %q", conn.currentMbox)
+	}
+}
+
+func TestSearchTimeoutReconnect(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { setCurrentMailboxStatus(nil) })
+
+	viper.Set("imap.search_timeout_reconnect", 2)
+	conn := newImapConn(newTestIMAPClient(t))
+	timeout := errors.New("IMAP UID search timed out after 30s")
+
+	// Without unseen mail, timeouts don't count
+	setCurrentMailboxStatus(&imap.MailboxStatus{Unseen: 0})
+	conn.recordSearch(timeout)
+	conn.recordSearch(timeout)
+	if reason := conn.reconnectReason(); reason != "" {
+		t.Fatalf("expected no reconnect without unseen mail, got %q", reason)
+	}
+
+	setCurrentMailboxStatus(&imap.MailboxStatus{Unseen: 3})
+	conn.recordSearch(timeout)
+	if reason := conn.reconnectReason(); reason != "" {
+		t.Fatalf("expected no reconnect below the threshold, got %q", reason)
+	}
+
+	// A successful search resets the count
+	conn.recordSearch(nil)
+	conn.recordSearch(timeout)
+	if reason := conn.reconnectReason(); reason != "" {
+		t.Fatalf("expected the count to be reset, got %q", reason)
+	}
+
+	// Other errors neither count nor reset
+	conn.recordSearch(errors.New("BAD command"))
+	conn.recordSearch(timeout)
+	if reason := conn.reconnectReason(); reason != "2 consecutive search timeouts" {
+		t.Errorf("expected a reconnect at the threshold, got %q", reason)
+	}
+}
+
+func TestIMAPLoginDisabled(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// Without insecure auth, the server advertises LOGINDISABLED on plaintext connections
+	srv := server.New(memory.New())
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	c, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Logout() })
+
+	err = imapLogin(c, "username", "password")
+	if err == nil || !strings.Contains(err.Error(), "imap.security") {
+		t.Errorf("expected an actionable LOGINDISABLED error, got %v", err)
+	}
+}
+
+func TestXOAuth2Client(t *testing.T) {
+	t.Parallel()
+
+	mech, ir, err := newXOAuth2Client("jane@example.com", "ya29.token").Start()
+	if err != nil || mech != "XOAUTH2" {
+		t.Fatalf("Start() = %q, %v", mech, err)
+	}
+	if want := "user=jane@example.com\x01auth=Bearer ya29.token\x01\x01"; string(ir) != want {
+		t.Errorf("initial response = %q, want %q", ir, want)
+	}
+}
+
+func TestSeparateSearchExamine(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { setCurrentMailboxStatus(nil) })
+
+	viper.Set("imap.separate_search_examine", true)
+
+	c := newTestIMAPClient(t)
+	conn := newImapConn(c)
+
+	if _, err := fetchMatchingMessagesWithConn(conn); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.readOnly || !c.Mailbox().ReadOnly {
+		t.Error("expected the search to run in a read-only selection")
+	}
+
+	if _, err := conn.selectMailbox(sourceMailbox, false); err != nil {
+		t.Fatal(err)
+	}
+	if conn.readOnly || c.Mailbox().ReadOnly {
+		t.Error("expected INBOX to be selected read-write again")
+	}
+}
+
+func TestSelectionStale(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	conn := &imapConn{}
+	conn.trackSelection("INBOX", false)
+	if conn.selectionStale() {
+		t.Error("expected a fresh selection to be current")
+	}
+
+	conn.selectStale = true
+	if !conn.selectionStale() {
+		t.Error("expected the selection to be stale after IDLE ended")
+	}
+	viper.Set("imap.reselect_after_idle", false)
+	if conn.selectionStale() {
+		t.Error("expected imap.reselect_after_idle: false to keep the selection")
+	}
+
+	viper.Set("imap.max_selection_age", "1m")
+	conn.selectedAt = time.Now().Add(-2 * time.Minute)
+	if !conn.selectionStale() {
+		t.Error("expected the selection to be stale after imap.max_selection_age")
+	}
+}
+
+func TestIdleShutdownRace(t *testing.T) {
+	t.Parallel()
+
+	// Cancelling serve closes the connection while a worker may be stopping IDLE for processing
+	// or restarting it afterwards; none of the orderings may close the stop channel twice or
+	// leave IDLE running on a closed connection, or hang
+	for range 10 {
+		conn := newImapConn(newTestIMAPClient(t))
+		if err := conn.startIdle(); err != nil {
+			t.Fatalf("failed to start IDLE: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			conn.stopIdle()
+			_ = conn.startIdle()
+		}()
+		go func() {
+			defer wg.Done()
+			conn.stopIdle()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = conn.close()
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(20 * time.Second):
+			t.Fatal("shutdown did not finish")
+		}
+
+		if err := conn.startIdle(); err != nil {
+			t.Fatalf("startIdle after close failed: %v", err)
+		}
+		conn.mu.Lock()
+		idling := conn.idling
+		conn.mu.Unlock()
+		if idling {
+			t.Fatal("IDLE must not be restarted on a closed connection")
+		}
+		if err := conn.close(); err != nil {
+			t.Errorf("closing twice should be a no-op, got %v", err)
+		}
+	}
+}
+
+func TestConfirmComplete(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	c := newTestIMAPClient(t)
+	viper.Set("fetch.confirm_complete", true)
+	viper.Set("fetch.settle_delay", "10ms")
+
+	// The stored message doesn't change, so two reads agree
+	started := time.Now()
+	if err := confirmComplete(c, 6, []string{"contact@example.org"}, false); err != nil {
+		t.Fatalf("a stable message should be complete: %v", err)
+	}
+	if time.Since(started) < 10*time.Millisecond {
+		t.Error("expected a matching message to wait for fetch.settle_delay")
+	}
+
+	// Messages that won't be forwarded are not waited for
+	viper.Set("fetch.settle_delay", "1h")
+	if err := confirmComplete(c, 6, []string{"someone@example.net"}, false); err != nil {
+		t.Fatalf("a non-matching message should not be checked: %v", err)
+	}
+
+	viper.Set("fetch.settle_delay", "0s")
+	messages, _, err := fetchMessagesRobustly(c, []uint32{6}, []string{"contact@example.org"})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("expected the complete message to be fetched, got %d messages, err %v", len(messages), err)
+	}
+}
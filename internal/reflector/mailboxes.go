@@ -0,0 +1,54 @@
+package reflector
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// MailboxInfo describes a folder on the IMAP server
+type MailboxInfo struct {
+	Name       string   `json:"name"`
+	Attributes []string `json:"attributes,omitempty"` // e.g. \Sent, \Trash or \Noselect
+}
+
+// listMailboxes returns all folders of the server with their (special-use) attributes
+func listMailboxes(c *client.Client) ([]*imap.MailboxInfo, error) {
+	mailboxes := make(chan *imap.MailboxInfo, mailboxesChanBufferSize)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	var infos []*imap.MailboxInfo
+	for m := range mailboxes {
+		infos = append(infos, m)
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	return infos, nil
+}
+
+// ListMailboxes connects to the configured IMAP server and returns its folders, so folder
+// names can be picked from the list instead of guessed
+func ListMailboxes() ([]MailboxInfo, error) {
+	c, err := connectAndLogin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.Logout() }()
+
+	infos, err := listMailboxes(c)
+	if err != nil {
+		return nil, err
+	}
+
+	mailboxes := make([]MailboxInfo, 0, len(infos))
+	for _, m := range infos {
+		mailboxes = append(mailboxes, MailboxInfo{Name: m.Name, Attributes: m.Attributes})
+	}
+	return mailboxes, nil
+}
@@ -1,11 +1,16 @@
 package reflector
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"strings"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
 )
 
 func markAsSeen(c *client.Client, uid uint32) error {
@@ -27,3 +32,110 @@ func markAsSeen(c *client.Client, uid uint32) error {
 	slog.Debug("Successfully marked message as seen", "uid", uid)
 	return nil
 }
+
+// markAsSeenWithRecovery marks a message as seen, retrying on a fresh connection if the
+// server closed the current one (e.g. some servers abort the connection during the
+// APPEND to the Sent folder), so a successful forward isn't repeated on the next run.
+func markAsSeenWithRecovery(c *client.Client, uid uint32) error {
+	err := markAsSeen(c, uid)
+	if err == nil || (!isConnectionClosed(c) && !isConnectionFatalError(err)) {
+		return err
+	}
+
+	slog.Warn("IMAP connection was closed, marking message as seen on a fresh connection", "uid", uid)
+
+	fresh, connErr := connectAndLogin()
+	if connErr != nil {
+		return fmt.Errorf("failed to reconnect to mark message %d as seen: %w", uid, connErr)
+	}
+	defer func() { _ = fresh.Logout() }()
+
+	return markAsSeen(fresh, uid)
+}
+
+// seenBatch collects the UIDs of successfully forwarded messages during a processing run,
+// so they can be marked as seen with a single UID STORE instead of one per message
+type seenBatch struct {
+	uids []uint32
+}
+
+// newSeenBatch returns a batch if `imap.batch_mark_seen` is enabled, or nil to mark messages
+// as seen one by one
+func newSeenBatch() *seenBatch {
+	if !viper.GetBool("imap.batch_mark_seen") {
+		return nil
+	}
+	return &seenBatch{}
+}
+
+// add queues a forwarded message to be marked as seen on flush
+func (b *seenBatch) add(uid uint32) {
+	b.uids = append(b.uids, uid)
+}
+
+// flush marks all queued messages as seen at once, retrying on a fresh connection if the
+// server closed the current one. A nil or empty batch is a no-op.
+func (b *seenBatch) flush(c *client.Client) error {
+	if b == nil || len(b.uids) == 0 {
+		return nil
+	}
+
+	uids := b.uids
+	b.uids = nil
+
+	err := markUIDsAsSeen(c, uids)
+	if err == nil || (!isConnectionClosed(c) && !isConnectionFatalError(err)) {
+		return err
+	}
+
+	slog.Warn("IMAP connection was closed, marking messages as seen on a fresh connection", "count", len(uids))
+
+	fresh, connErr := connectAndLogin()
+	if connErr != nil {
+		return fmt.Errorf("failed to reconnect to mark %d messages as seen: %w", len(uids), connErr)
+	}
+	defer func() { _ = fresh.Logout() }()
+
+	return markUIDsAsSeen(fresh, uids)
+}
+
+// markUIDsAsSeen sets the \Seen flag on all given messages with a single UID STORE
+func markUIDsAsSeen(c *client.Client, uids []uint32) error {
+	slog.Debug("Marking messages as seen", "uids", uids, "count", len(uids))
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true) // true = silent update
+	flags := []any{imap.SeenFlag}
+
+	if err := c.UidStore(seqset, item, flags, nil); err != nil {
+		slog.Error("Failed to mark messages as seen", "uids", uids, "error", err)
+		return fmt.Errorf("failed to mark %d messages as \\Seen: %w", len(uids), err)
+	}
+
+	slog.Info("Marked forwarded messages as seen", "count", len(uids))
+	return nil
+}
+
+// isConnectionClosed reports whether the IMAP connection has been closed or logged out
+func isConnectionClosed(c *client.Client) bool {
+	select {
+	case <-c.LoggedOut():
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnectionFatalError checks if an error means the underlying connection is unusable
+func isConnectionFatalError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, client.ErrNotLoggedIn) {
+		return true
+	}
+
+	errorStr := strings.ToLower(err.Error())
+	return strings.Contains(errorStr, "connection reset") ||
+		strings.Contains(errorStr, "broken pipe") ||
+		strings.Contains(errorStr, "connection closed")
+}
@@ -0,0 +1,142 @@
+package reflector
+
+import (
+	"regexp"
+	"strings"
+)
+
+// patternMatcher matches addresses or domains against a list of patterns.
+// Patterns may contain `*` wildcards (e.g. `*@example.org`, `*.test`) and may be
+// negated with a leading `!` (e.g. `!spammer@example.org`). Negations always win:
+// a value matches if it matches at least one allow pattern and no negated pattern.
+type patternMatcher struct {
+	allow []string
+	deny  []string
+}
+
+// newPatternMatcher builds a case-insensitive matcher from the configured patterns
+func newPatternMatcher(patterns []string) patternMatcher {
+	var m patternMatcher
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			if negated != "" {
+				m.deny = append(m.deny, negated)
+			}
+			continue
+		}
+		if p != "" {
+			m.allow = append(m.allow, p)
+		}
+	}
+	return m
+}
+
+// Match reports whether value is allowed by the patterns
+func (m patternMatcher) Match(value string) bool {
+	_, ok := m.MatchedPattern(value)
+	return ok
+}
+
+// MatchedPattern returns the allow pattern that matched value, if value is allowed
+func (m patternMatcher) MatchedPattern(value string) (string, bool) {
+	value = strings.ToLower(value)
+	for _, p := range m.deny {
+		if matchWildcard(p, value) {
+			return "", false
+		}
+	}
+	for _, p := range m.allow {
+		if matchWildcard(p, value) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// matchWildcard matches value against pattern, where `*` matches any (possibly empty) sequence
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	// The first part is anchored at the start, the last at the end
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(value, part)
+		if idx < 0 {
+			return false
+		}
+		value = value[idx+len(part):]
+	}
+
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+// compileSubjectPattern turns a `filter.subject` entry into a case-insensitive regular
+// expression: `/.../` entries are regular expressions, all others match as substrings
+func compileSubjectPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+	}
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(pattern))
+}
+
+// compileAttachmentNamePattern turns a `filter.attachment_name` entry into a case-insensitive
+// regular expression: `/.../` entries are regular expressions, all others are globs where `*`
+// matches any sequence and `?` a single character
+func compileAttachmentNamePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+	}
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.ReplaceAll(glob, `\*`, ".*")
+	glob = strings.ReplaceAll(glob, `\?`, ".")
+	return regexp.Compile("(?i)^" + glob + "$")
+}
+
+// matchAttachmentNames reports whether at least one of the filenames matches one of the
+// patterns; without patterns every message matches, with patterns one without attachments
+// never does. Invalid regular expressions never match (ValidateConfig reports them).
+func matchAttachmentNames(filenames, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		re, err := compileAttachmentNamePattern(p)
+		if err != nil {
+			continue
+		}
+		for _, name := range filenames {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSubject reports whether subject matches at least one of the patterns; without patterns
+// every subject matches, with patterns an empty subject never does. Invalid regular expressions
+// never match (ValidateConfig reports them).
+func matchSubject(subject string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if subject == "" {
+		return false
+	}
+	for _, p := range patterns {
+		re, err := compileSubjectPattern(p)
+		if err == nil && re.MatchString(subject) {
+			return true
+		}
+	}
+	return false
+}
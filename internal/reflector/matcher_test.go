@@ -0,0 +1,188 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+)
+
+func TestPatternMatcher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		patterns []string
+		value    string
+		want     bool
+	}{
+		{"exact match", []string{"vorstand@example.com"}, "Vorstand@Example.com", true},
+		{"no match", []string{"vorstand@example.com"}, "other@example.com", false},
+		{"domain wildcard", []string{"*@example.com"}, "anyone@example.com", true},
+		{"wildcard doesn't cross domains", []string{"*@example.com"}, "anyone@example.com.evil", false},
+		{"negation wins over wildcard", []string{"*@example.com", "!spammer@example.com"}, "spammer@example.com", false},
+		{"negation order is irrelevant", []string{"!spammer@example.com", "*@example.com"}, "spammer@example.com", false},
+		{"others still allowed", []string{"*@example.com", "!spammer@example.com"}, "vorstand@example.com", true},
+		{"negation wins over exact entry", []string{"a@example.com", "!a@example.com"}, "a@example.com", false},
+		{"only negations allow nothing", []string{"!spammer@example.com"}, "vorstand@example.com", false},
+		{"subdomain wildcard", []string{"*.example.org", "!*.test.example.org"}, "mail.example.org", true},
+		{"negated subdomain wildcard", []string{"*.example.org", "!*.test.example.org"}, "a.test.example.org", false},
+		{"wildcard in the middle", []string{"board-*@example.org"}, "board-2024@example.org", true},
+		{"overlapping prefix and suffix", []string{"a*a"}, "a", false},
+		{"empty patterns", nil, "a@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := newPatternMatcher(tt.patterns).Match(tt.value); got != tt.want {
+				t.Errorf("Match(%q) with %v = %v, want %v", tt.value, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchedFilter(t *testing.T) {
+	t.Parallel()
+
+	filters := []string{"vorstand@example.com", "*@board.example.org", "!spam@board.example.org"}
+
+	if got := matchedFilter("Kassenwart@Board.example.org", filters); got != "*@board.example.org" {
+		t.Errorf("matchedFilter = %q, want the wildcard entry", got)
+	}
+	if got := matchedFilter("spam@board.example.org", filters); got != "" {
+		t.Errorf("negated sender should not report a match, got %q", got)
+	}
+}
+
+func TestExcludeDomains(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	filters := []string{"*@example.org", "vorstand@other.example"}
+	viper.Set("filter.exclude_domains", []string{"example.org", "*.other.example"})
+
+	if isAddressMatching("colleague@example.org", filters) {
+		t.Error("sender from an excluded domain should not match")
+	}
+	if !isAddressMatching("vorstand@other.example", filters) {
+		t.Error("a subdomain wildcard should not exclude the parent domain")
+	}
+	if isAddressMatching("vorstand@mail.other.example", []string{"*"}) {
+		t.Error("sender from an excluded subdomain should not match")
+	}
+}
+
+func TestIsSubjectMatching(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{"newsletter", "/^\\[board\\]/"}
+
+	tests := []struct {
+		name     string
+		envelope *imap.Envelope
+		patterns []string
+		want     bool
+	}{
+		{"case-insensitive substring", &imap.Envelope{Subject: "Our NEWSLETTER for May"}, patterns, true},
+		{"regex", &imap.Envelope{Subject: "[Board] Meeting"}, patterns, true},
+		{"regex is anchored", &imap.Envelope{Subject: "Re: [board] Meeting"}, patterns, false},
+		{"no match", &imap.Envelope{Subject: "Invoice"}, patterns, false},
+		{"empty subject", &imap.Envelope{}, patterns, false},
+		{"nil envelope", nil, patterns, false},
+		{"no patterns", &imap.Envelope{}, nil, true},
+		{"substrings are literal", &imap.Envelope{Subject: "a+b"}, []string{"a+b"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := isSubjectMatching(tt.envelope, tt.patterns); got != tt.want {
+			t.Errorf("%s: isSubjectMatching = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsMessageMatching(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	envelope := func(from, subject string) *imap.Envelope {
+		mailbox, host, _ := strings.Cut(from, "@")
+		return &imap.Envelope{Subject: subject, From: []*imap.Address{{MailboxName: mailbox, HostName: host}}}
+	}
+	filters := []string{"vorstand@example.com"}
+
+	if !isMessageMatching(envelope("vorstand@example.com", "Anything"), filters) {
+		t.Error("sender filter alone should match")
+	}
+
+	viper.Set("filter.subject", []string{"newsletter"})
+	if isMessageMatching(envelope("vorstand@example.com", "Anything"), filters) {
+		t.Error("with both filters, the subject must match too")
+	}
+	if !isMessageMatching(envelope("vorstand@example.com", "Newsletter"), filters) {
+		t.Error("expected a match when sender and subject match")
+	}
+	if isMessageMatching(envelope("other@example.com", "Newsletter"), filters) {
+		t.Error("with both filters, the sender must match too")
+	}
+	if !isMessageMatching(envelope("other@example.com", "Newsletter"), nil) {
+		t.Error("subject filter alone should match any sender")
+	}
+}
+
+func TestMatchAttachmentNames(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{"*.ics", "minutes-*.pdf", "/^agenda-\\d+\\.docx$/"}
+	for _, tc := range []struct {
+		names []string
+		want  bool
+	}{
+		{[]string{"invite.ics"}, true},
+		{[]string{"logo.png", "Minutes-2024-03.PDF"}, true},
+		{[]string{"agenda-12.docx"}, true},
+		{[]string{"minutes.pdf", "invite.ics.exe", "agenda-x.docx"}, false},
+		{nil, false},
+	} {
+		if got := matchAttachmentNames(tc.names, patterns); got != tc.want {
+			t.Errorf("matchAttachmentNames(%q) = %v, want %v", tc.names, got, tc.want)
+		}
+	}
+
+	if !matchAttachmentNames(nil, nil) {
+		t.Error("without patterns every message should match")
+	}
+}
+
+func TestHasMatchingAttachmentEncodedName(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	raw := "Content-Type: multipart/mixed; boundary=\"xyz\"\r\n" +
+		"\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Anbei das Protokoll.\r\n" +
+		"--xyz\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=\"=?UTF-8?B?UHJvdG9rb2xsLU3DpHJ6LnBkZg==?=\"\r\n" +
+		"\r\n" +
+		"%PDF\r\n" +
+		"--xyz--\r\n"
+
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	_, _, attachments, _ := extractBodies(entity)
+	mail := MailSummary{Attachments: attachments}
+
+	viper.Set("filter.attachment_name", []string{"Protokoll-März*"})
+	if !hasMatchingAttachment(mail) {
+		t.Errorf("expected the decoded filename to match, got %+v", attachments)
+	}
+	viper.Set("filter.attachment_name", []string{"*.ics"})
+	if hasMatchingAttachment(mail) {
+		t.Error("expected no match for other filenames")
+	}
+}
@@ -0,0 +1,149 @@
+package reflector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/gomail.v2"
+)
+
+// notifyTimeout bounds the delivery of a single notification
+const notifyTimeout = 10 * time.Second
+
+// notification is an event an operator should know about without reading the logs
+type notification struct {
+	Event   string            `json:"event"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// notifier holds the notification settings, read from the config when a notification is
+// raised, so it can be delivered in the background while the config is reloaded
+type notifier struct {
+	webhookURL   string
+	email        string
+	from         string // From header of notification emails
+	envelopeFrom string
+	dialer       *gomail.Dialer
+}
+
+// notifyWG tracks notifications sent in the background (see notifyAsync)
+var notifyWG sync.WaitGroup
+
+// currentNotifier reads the notification settings from the config
+func currentNotifier() notifier {
+	n := notifier{
+		webhookURL: viper.GetString("notify.webhook_url"),
+		email:      viper.GetString("notify.email"),
+	}
+	if n.email != "" {
+		n.from = viper.GetString("smtp.username")
+		n.envelopeFrom = envelopeSender(n.from)
+		n.dialer = newSMTPDialer()
+	}
+	return n
+}
+
+// notificationsConfigured reports whether any notification channel is set up
+func notificationsConfigured() bool {
+	return viper.GetString("notify.webhook_url") != "" || viper.GetString("notify.email") != ""
+}
+
+// notify sends a notification to `notify.webhook_url` (as a JSON POST) and `notify.email`,
+// whichever are configured. Failures are logged, as notifications are best effort.
+func notify(event, message string, fields map[string]string) {
+	currentNotifier().send(event, message, fields)
+}
+
+// notifyAsync is notify in the background, for callers that must not wait for delivery. The
+// settings are read before it returns.
+func notifyAsync(event, message string, fields map[string]string) {
+	nt := currentNotifier()
+	notifyWG.Add(1)
+	go func() {
+		defer notifyWG.Done()
+		nt.send(event, message, fields)
+	}()
+}
+
+// waitForNotifications waits for notifications sent in the background to be delivered
+func waitForNotifications() {
+	notifyWG.Wait()
+}
+
+// send delivers a notification to the configured webhook and email address
+func (nt notifier) send(event, message string, fields map[string]string) {
+	n := notification{Event: event, Message: message, Fields: fields, Time: time.Now()}
+
+	if nt.webhookURL != "" {
+		if err := postNotification(nt.webhookURL, n); err != nil {
+			slog.Error("Failed to send notification to webhook", "event", event, "error", err)
+		}
+	}
+	if nt.email != "" {
+		if err := nt.mailNotification(n); err != nil {
+			slog.Error("Failed to send notification email", "event", event, "to", nt.email, "error", err)
+		}
+	}
+}
+
+// postNotification posts n as JSON to url
+func postNotification(url string, n notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// mailNotification sends n as a plain-text mail to the operator address
+func (nt notifier) mailNotification(n notification) error {
+
+	var body strings.Builder
+	body.WriteString(n.Message + "\n")
+	keys := make([]string, 0, len(n.Fields))
+	for key := range n.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&body, "\n%s: %s", key, n.Fields[key])
+	}
+
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", formatAddressHeader(nt.from))
+	msg.SetHeader("To", nt.email)
+	msg.SetHeader("Subject", "[mail-reflector] "+n.Event)
+	msg.SetBody("text/plain", body.String())
+
+	return sendMessageWith(nt.dialer, nt.envelopeFrom, []string{recipientKey(nt.email)}, msg)
+}
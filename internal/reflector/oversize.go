@@ -0,0 +1,112 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Policies for messages exceeding `forward.max_size`
+const (
+	oversizeSkip    = "skip"    // don't forward, only mark as seen (default)
+	oversizePreview = "preview" // forward a truncated text preview without attachments
+)
+
+// defaultPreviewChars is how much of the text body an oversize preview includes
+const defaultPreviewChars = 2000
+
+// messageSize approximates the size of a forward from its bodies and attachments
+func messageSize(mail MailSummary) int {
+	if mail.Raw != nil {
+		return len(mail.Raw)
+	}
+	size := len(mail.TextBody) + len(mail.HTMLBody)
+	for _, att := range mail.Attachments {
+		size += len(att.Data)
+	}
+	for _, img := range mail.InlineImages {
+		size += len(img.Data)
+	}
+	return size
+}
+
+// applySizeLimit checks a message against `forward.max_size` and applies `forward.oversize_policy`.
+// It returns the message to forward (possibly replaced by a preview) and false if it must not be
+// forwarded at all.
+func applySizeLimit(mail MailSummary) (MailSummary, bool) {
+	limit := int(viper.GetSizeInBytes("forward.max_size"))
+	size := messageSize(mail)
+	if limit <= 0 || size <= limit {
+		return mail, true
+	}
+
+	policy := viper.GetString("forward.oversize_policy")
+	switch policy {
+	case oversizePreview:
+		slog.Info("Message exceeds size limit, forwarding a preview", "uid", mail.UID, "size", size, "limit", limit)
+		return buildOversizePreview(mail, size), true
+	case "", oversizeSkip:
+		slog.Warn("Message exceeds size limit, not forwarding it", "uid", mail.UID, "size", size, "limit", limit)
+		return mail, false
+	default:
+		slog.Warn("Unknown forward.oversize_policy, not forwarding oversized message", "policy", policy, "uid", mail.UID)
+		return mail, false
+	}
+}
+
+// buildOversizePreview replaces the bodies and attachments of an oversized message with a
+// plain-text note, the beginning of the text body and a list of the omitted attachments.
+// With `forward.oversize_reference` the mailbox and UID are included so admins can retrieve
+// the original.
+func buildOversizePreview(mail MailSummary, size int) MailSummary {
+	chars := defaultPreviewChars
+	if viper.IsSet("forward.preview_chars") {
+		chars = viper.GetInt("forward.preview_chars")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[This message (%s) exceeded the size limit. Only a preview is forwarded.]\n", formatSize(size))
+	if viper.GetBool("forward.oversize_reference") {
+		fmt.Fprintf(&b, "[Original: mailbox INBOX, UID %d]\n", mail.UID)
+	}
+	b.WriteString("\n")
+
+	text := []rune(mail.TextBody)
+	if len(text) > chars {
+		b.WriteString(string(text[:chars]))
+		b.WriteString("\n[...]\n")
+	} else {
+		b.WriteString(mail.TextBody)
+		b.WriteString("\n")
+	}
+
+	if len(mail.Attachments) > 0 {
+		b.WriteString("\nAttachments not forwarded:\n")
+		for _, att := range mail.Attachments {
+			fmt.Fprintf(&b, "- %s (%s, %s)\n", att.Filename, att.ContentType, formatSize(len(att.Data)))
+		}
+	}
+
+	mail.TextBody = b.String()
+	mail.HTMLBody = ""
+	mail.Attachments = nil
+	mail.InlineImages = nil
+	mail.Raw = nil // the preview is always composed, also in pass-through mode
+	return mail
+}
+
+// formatSize renders a byte count for humans, e.g. "12.5 MB"
+func formatSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,54 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestApplySizeLimit(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	mail := MailSummary{
+		Envelope: &imap.Envelope{Subject: "Protokoll"},
+		UID:      42,
+		TextBody: strings.Repeat("x", 100),
+		HTMLBody: "<p>html</p>",
+		Attachments: []Attachment{
+			{Filename: "scan.pdf", ContentType: "application/pdf", Data: make([]byte, 2048)},
+		},
+	}
+
+	// No limit configured
+	if got, ok := applySizeLimit(mail); !ok || len(got.Attachments) != 1 {
+		t.Fatal("message should be forwarded unchanged without a limit")
+	}
+
+	viper.Set("forward.max_size", "1KB")
+
+	if _, ok := applySizeLimit(mail); ok {
+		t.Error("oversized message should be skipped by default")
+	}
+
+	viper.Set("forward.oversize_policy", "preview")
+	viper.Set("forward.preview_chars", 10)
+	viper.Set("forward.oversize_reference", true)
+
+	preview, ok := applySizeLimit(mail)
+	if !ok {
+		t.Fatal("preview policy should forward the message")
+	}
+	if preview.HTMLBody != "" || len(preview.Attachments) != 0 {
+		t.Error("preview should drop the HTML body and attachments")
+	}
+	for _, want := range []string{"exceeded the size limit", "UID 42", strings.Repeat("x", 10) + "\n[...]", "- scan.pdf (application/pdf, 2.0 KB)"} {
+		if !strings.Contains(preview.TextBody, want) {
+			t.Errorf("preview is missing %q:\n%s", want, preview.TextBody)
+		}
+	}
+	if strings.Contains(preview.TextBody, strings.Repeat("x", 11)) {
+		t.Error("preview text wasn't truncated")
+	}
+}
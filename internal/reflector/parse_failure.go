@@ -0,0 +1,81 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// What happens to a matching message that repeatedly can't be parsed (`forward.on_parse_failure`)
+const (
+	parseFailureSkip       = "skip"        // leave it unseen and stop retrying (default)
+	parseFailureForwardRaw = "forward_raw" // forward it with the original attached as message/rfc822
+	parseFailureNotify     = "notify"      // like skip, but send a notification (see notify)
+)
+
+// parseFailurePolicy returns the configured `forward.on_parse_failure`
+func parseFailurePolicy() string {
+	switch policy := viper.GetString("forward.on_parse_failure"); policy {
+	case parseFailureForwardRaw, parseFailureNotify:
+		return policy
+	default:
+		return parseFailureSkip
+	}
+}
+
+// parseError reports a matching message whose MIME structure can't be parsed, unlike fetch
+// errors and timeouts. The summary holds what is known without parsing, including the raw
+// message when it was kept.
+type parseError struct {
+	summary MailSummary
+	err     error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("failed to parse message %d: %v", e.summary.UID, e.err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// handleParseFailure applies `forward.on_parse_failure` to a message that has failed to parse
+// repeatedly. With forward_raw it returns a summary forwarding the original unchanged as an
+// attachment; otherwise it returns nil and the message is skipped from now on.
+func handleParseFailure(pe *parseError) *MailSummary {
+	mail := pe.summary
+	subject := ""
+	if mail.Envelope != nil {
+		subject = mail.Envelope.Subject
+	}
+
+	switch parseFailurePolicy() {
+	case parseFailureForwardRaw:
+		if mail.Raw == nil {
+			return nil
+		}
+		slog.Warn("Message can't be parsed, forwarding the original as attachment", "uid", mail.UID, "subject", subject, "error", pe.err)
+
+		// Let the next run try again if the forward fails
+		clearProblematicUID(mail.UID)
+
+		mail.TextBody = "This message could not be processed and is attached unchanged."
+		mail.Attachments = []Attachment{{
+			Filename:    "original.eml",
+			ContentType: "message/rfc822",
+			Data:        mail.Raw,
+		}}
+		mail.Raw = nil // always composed, the original's headers may be what can't be parsed
+		return &mail
+	case parseFailureNotify:
+		notify("parse_failure", "A matching message could not be parsed and was not forwarded.", map[string]string{
+			"uid":     strconv.FormatUint(uint64(mail.UID), 10),
+			"from":    getFromAddress(mail.Envelope),
+			"subject": subject,
+			"error":   pe.err.Error(),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package reflector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestHandleParseFailure(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	raw := []byte("From: broken\r\nContent-Type: multipart/mixed\r\n\r\n??")
+	pe := &parseError{
+		summary: MailSummary{UID: 9001, Envelope: &imap.Envelope{Subject: "Announcement"}, Raw: raw},
+		err:     errors.New("malformed MIME header"),
+	}
+
+	if got := handleParseFailure(pe); got != nil {
+		t.Errorf("skip should not forward anything, got %+v", got)
+	}
+
+	viper.Set("forward.on_parse_failure", "forward_raw")
+	got := handleParseFailure(pe)
+	if got == nil || len(got.Attachments) != 1 {
+		t.Fatalf("expected the original as attachment, got %+v", got)
+	}
+	if att := got.Attachments[0]; att.ContentType != "message/rfc822" || string(att.Data) != string(raw) {
+		t.Errorf("unexpected attachment %+v", att)
+	}
+	if got.Raw != nil || got.TextBody == "" {
+		t.Errorf("the fallback should be composed with an explanation, got %+v", got)
+	}
+
+	var received notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	t.Cleanup(srv.Close)
+
+	viper.Set("forward.on_parse_failure", "notify")
+	viper.Set("notify.webhook_url", srv.URL)
+	if got := handleParseFailure(pe); got != nil {
+		t.Errorf("notify should not forward anything, got %+v", got)
+	}
+	if received.Event != "parse_failure" || received.Fields["subject"] != "Announcement" || received.Fields["uid"] != "9001" {
+		t.Errorf("unexpected notification %+v", received)
+	}
+}
@@ -0,0 +1,80 @@
+package reflector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/emersion/go-message/textproto"
+	"github.com/spf13/viper"
+)
+
+// Forward modes controlling how the outgoing message is built
+const (
+	forwardModeBcc         = "bcc"         // recompose bodies and attachments, recipients in Bcc (default)
+	forwardModeTo          = "to"          // recompose like bcc, but address the recipients openly in To
+	forwardModePassthrough = "passthrough" // resend the original MIME structure with rewritten headers
+)
+
+// forwardMode returns the configured `forward.mode`
+func forwardMode() string {
+	switch mode := viper.GetString("forward.mode"); mode {
+	case forwardModeTo, forwardModePassthrough:
+		return mode
+	default:
+		return forwardModeBcc
+	}
+}
+
+// passthroughDroppedHeaders are removed from the original before re-addressing it: trace and
+// delivery headers of the original hop, signatures that no longer verify once From/Subject
+// change, and recipient lists that must not be exposed to or replied to by the list
+var passthroughDroppedHeaders = []string{
+	"Return-Path", "Delivered-To", "X-Original-To",
+	"DKIM-Signature", "ARC-Seal", "ARC-Message-Signature", "ARC-Authentication-Results",
+	"To", "Cc", "Bcc",
+}
+
+// buildPassthroughMessage re-addresses the original message without touching its body, so
+// signed, encrypted and nested MIME structures arrive intact. Only the top-level headers
+// needed for the forward are rewritten; recipients go into the SMTP envelope only.
+func buildPassthroughMessage(original MailSummary, from, to, reply, subject string) ([]byte, error) {
+	br := bufio.NewReader(bytes.NewReader(original.Raw))
+	header, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original header: %w", err)
+	}
+
+	for _, key := range passthroughDroppedHeaders {
+		header.Del(key)
+	}
+
+	header.Set("From", formatAddressHeader(from))
+	header.Set("To", to)
+	header.Set("Reply-To", reply)
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+
+	if inReplyTo, references := threadingHeaders(original); inReplyTo != "" {
+		header.Set("In-Reply-To", inReplyTo)
+		header.Set("References", references)
+	}
+
+	for key, value := range debugHeaders(original) {
+		header.Set(key, value)
+	}
+	for key, value := range priorityHeaders(original) {
+		header.Set(key, value)
+	}
+
+	var buf bytes.Buffer
+	if err := textproto.WriteHeader(&buf, header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := io.Copy(&buf, br); err != nil {
+		return nil, fmt.Errorf("failed to copy original body: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
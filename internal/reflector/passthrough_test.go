@@ -0,0 +1,61 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestBuildPassthroughMessage(t *testing.T) {
+	t.Parallel()
+
+	body := "--sig\r\nContent-Type: text/plain\r\n\r\nSigned text\r\n--sig\r\nContent-Type: application/pkcs7-signature\r\n\r\nMIAGCSqGSIb3\r\n--sig--\r\n"
+	raw := "Return-Path: <jane@example.com>\r\n" +
+		"Delivered-To: board@example.org\r\n" +
+		"DKIM-Signature: v=1; d=example.com; b=abc\r\n" +
+		"From: Jane <jane@example.com>\r\n" +
+		"To: board@example.org\r\n" +
+		"Cc: someone@example.net\r\n" +
+		"Subject: Signed\r\n" +
+		"Message-Id: <1@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; boundary=sig\r\n" +
+		"\r\n" + body
+
+	original := MailSummary{
+		Envelope: &imap.Envelope{Subject: "Signed", MessageId: "<1@example.com>"},
+		Raw:      []byte(raw),
+	}
+
+	out, err := buildPassthroughMessage(original, "Board <board@example.org>", "<jane@example.com>", "<jane@example.com>", "[Board] Signed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header, gotBody, ok := strings.Cut(string(out), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no header/body separator in %q", out)
+	}
+
+	if gotBody != body {
+		t.Errorf("body was modified:\n%q\nwant\n%q", gotBody, body)
+	}
+
+	for _, want := range []string{
+		`From: "Board" <board@example.org>`,
+		"To: <jane@example.com>",
+		"Subject: [Board] Signed",
+		"Message-Id: <1@example.com>",
+		`boundary=sig`,
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header is missing %q:\n%s", want, header)
+		}
+	}
+	for _, dropped := range []string{"Return-Path", "Delivered-To", "DKIM-Signature", "Cc:", "board@example.org\r\nCc"} {
+		if strings.Contains(header, dropped) {
+			t.Errorf("header should not contain %q:\n%s", dropped, header)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package reflector
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// pausedAtRuntime is set by Pause and cleared by Resume (the web UI's /pause and /resume).
+// Unlike `enabled: false` it doesn't survive a restart.
+var pausedAtRuntime atomic.Bool
+
+// resumeSignal wakes the serve loop to process the messages left unseen while paused
+var resumeSignal = make(chan struct{}, 1)
+
+// Pause pauses forwarding until Resume is called, like `enabled: false`
+func Pause() {
+	pausedAtRuntime.Store(true)
+	slog.Info("Forwarding paused")
+}
+
+// Resume lifts a Pause. Forwarding stays paused while the config has `enabled: false`.
+func Resume() {
+	pausedAtRuntime.Store(false)
+	if !forwardingEnabled() {
+		slog.Info("Forwarding resumed, but still disabled by the config (enabled: false)")
+		return
+	}
+	slog.Info("Forwarding resumed")
+	signalResumed()
+}
+
+// signalResumed wakes the serve loop after forwarding was re-enabled, without blocking
+func signalResumed() {
+	select {
+	case resumeSignal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,39 @@
+package reflector
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPauseResume(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { pausedAtRuntime.Store(false) })
+
+	Pause()
+	if forwardingEnabled() {
+		t.Fatal("expected forwarding to be paused")
+	}
+	Resume()
+	if !forwardingEnabled() {
+		t.Fatal("expected forwarding to be resumed")
+	}
+	select {
+	case <-resumeSignal:
+	default:
+		t.Error("expected resuming to wake the serve loop")
+	}
+
+	// Resuming doesn't override `enabled: false`
+	viper.Set("enabled", false)
+	Pause()
+	Resume()
+	if forwardingEnabled() {
+		t.Error("expected forwarding to stay disabled by the config")
+	}
+	select {
+	case <-resumeSignal:
+		t.Error("resuming while disabled by the config should not wake the serve loop")
+	default:
+	}
+}
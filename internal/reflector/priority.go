@@ -0,0 +1,67 @@
+package reflector
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Priority levels of `forward.priority`
+const (
+	priorityLow      = "low"
+	priorityNormal   = "normal"
+	priorityHigh     = "high"
+	priorityPreserve = "preserve" // take the level from the original's priority headers
+)
+
+// priorityHeaderValues are the X-Priority, Importance and Priority headers (RFC 2156) that
+// the common mail clients understand, per level
+var priorityHeaderValues = map[string]map[string]string{
+	priorityLow:    {"X-Priority": "5 (Lowest)", "Importance": "low", "Priority": "non-urgent"},
+	priorityNormal: {"X-Priority": "3 (Normal)", "Importance": "normal", "Priority": "normal"},
+	priorityHigh:   {"X-Priority": "1 (Highest)", "Importance": "high", "Priority": "urgent"},
+}
+
+// priorityHeaders returns the priority headers for a forward of original according to
+// `forward.priority`, or nil to set none (the default)
+func priorityHeaders(original MailSummary) map[string]string {
+	level := strings.ToLower(viper.GetString("forward.priority"))
+	if level == priorityPreserve {
+		level = originalPriority(original)
+	}
+	return priorityHeaderValues[level]
+}
+
+// originalPriority derives the level from the original's X-Priority, Importance or Priority
+// header, or returns "" if it has none
+func originalPriority(original MailSummary) string {
+	if v := strings.TrimSpace(original.Headers.Get("X-Priority")); v != "" {
+		switch v[0] {
+		case '1', '2':
+			return priorityHigh
+		case '4', '5':
+			return priorityLow
+		default:
+			return priorityNormal
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(original.Headers.Get("Importance"))) {
+	case "high":
+		return priorityHigh
+	case "low":
+		return priorityLow
+	case "normal":
+		return priorityNormal
+	}
+
+	switch strings.ToLower(strings.TrimSpace(original.Headers.Get("Priority"))) {
+	case "urgent":
+		return priorityHigh
+	case "non-urgent":
+		return priorityLow
+	case "normal":
+		return priorityNormal
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package reflector
+
+import (
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+)
+
+func TestPriorityHeaders(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if got := priorityHeaders(MailSummary{}); got != nil {
+		t.Errorf("no priority headers should be set by default, got %v", got)
+	}
+
+	for level, want := range map[string][3]string{
+		"low":    {"5 (Lowest)", "low", "non-urgent"},
+		"normal": {"3 (Normal)", "normal", "normal"},
+		"high":   {"1 (Highest)", "high", "urgent"},
+	} {
+		viper.Set("forward.priority", level)
+		got := priorityHeaders(MailSummary{})
+		if got["X-Priority"] != want[0] || got["Importance"] != want[1] || got["Priority"] != want[2] {
+			t.Errorf("%s: got %v, want %v", level, got, want)
+		}
+	}
+
+	viper.Set("forward.priority", "preserve")
+	for header, want := range map[[2]string]string{
+		{"X-Priority", "2 (High)"}:   "1 (Highest)",
+		{"X-Priority", "5"}:          "5 (Lowest)",
+		{"Importance", "High"}:       "1 (Highest)",
+		{"Priority", "non-urgent"}:   "5 (Lowest)",
+		{"X-Mailer", "not priority"}: "",
+	} {
+		var h message.Header
+		h.Set(header[0], header[1])
+		if got := priorityHeaders(MailSummary{Headers: h})["X-Priority"]; got != want {
+			t.Errorf("preserve %s: %s = %q, want %q", header[0], header[1], got, want)
+		}
+	}
+}
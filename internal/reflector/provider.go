@@ -0,0 +1,110 @@
+package reflector
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// providerProfile captures known quirks of a mail provider so users don't have to rediscover them
+type providerProfile struct {
+	// SentFolders lists Sent folder names to try, in order of likelihood
+	SentFolders []string
+	// SaveToSent controls whether forwarded mails are appended to the Sent folder via IMAP.
+	// Disabled for providers that already store SMTP-submitted mail in Sent themselves.
+	SaveToSent bool
+	// PreferSpecialUse tries the folder flagged with the \Sent special-use attribute first
+	PreferSpecialUse bool
+}
+
+// defaultSentFolders are common Sent folder names (including German providers like Strato)
+var defaultSentFolders = []string{
+	"Sent Items",
+	"Sent Messages",
+	"Sent",
+	"Gesendet",
+	"Gesendete Elemente",
+	"Gesendete Objekte",
+	"INBOX.Sent",
+	"INBOX.Sent Items",
+	"INBOX.Gesendet",
+}
+
+// providerProfiles maps the `provider` config value to its known quirks
+var providerProfiles = map[string]providerProfile{
+	"generic": {
+		SentFolders:      defaultSentFolders,
+		SaveToSent:       true,
+		PreferSpecialUse: true,
+	},
+	"strato": {
+		// Strato names the folder "Gesendete Objekte" and doesn't advertise special-use flags
+		SentFolders: []string{"Gesendete Objekte", "Gesendet", "Sent", "INBOX.Sent"},
+		SaveToSent:  true,
+	},
+	"gmail": {
+		// Gmail stores mail submitted via SMTP in "Sent Mail" automatically
+		SentFolders:      []string{"[Gmail]/Sent Mail", "[Gmail]/Gesendet", "[Google Mail]/Sent Mail", "[Google Mail]/Gesendet"},
+		SaveToSent:       false,
+		PreferSpecialUse: true,
+	},
+	"gmx": {
+		SentFolders: []string{"Gesendet", "Sent"},
+		SaveToSent:  true,
+	},
+	"webde": {
+		SentFolders: []string{"Gesendet", "Sent"},
+		SaveToSent:  true,
+	},
+	"ionos": {
+		SentFolders:      []string{"Gesendete Objekte", "Sent Items", "Sent"},
+		SaveToSent:       true,
+		PreferSpecialUse: true,
+	},
+	"outlook": {
+		// Outlook.com / Office 365 store mail submitted via SMTP in "Sent Items" automatically
+		SentFolders:      []string{"Sent Items", "Gesendete Elemente", "Sent"},
+		SaveToSent:       false,
+		PreferSpecialUse: true,
+	},
+}
+
+// KnownProviders returns the names of all built-in provider profiles
+func KnownProviders() []string {
+	names := make([]string, 0, len(providerProfiles))
+	for name := range providerProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsKnownProvider reports whether a built-in profile exists for the given provider name
+func IsKnownProvider(name string) bool {
+	_, ok := providerProfiles[strings.ToLower(name)]
+	return ok
+}
+
+// activeProfile returns the profile selected by the `provider` config value,
+// with explicit configuration applied on top of it
+func activeProfile() providerProfile {
+	name := strings.ToLower(viper.GetString("provider"))
+	if name == "" {
+		name = "generic"
+	}
+
+	profile, ok := providerProfiles[name]
+	if !ok {
+		slog.Debug("Unknown provider profile, using generic", "provider", name)
+		profile = providerProfiles["generic"]
+	}
+
+	// Explicit configuration always wins over the profile defaults
+	if viper.IsSet("imap.save_to_sent") {
+		profile.SaveToSent = viper.GetBool("imap.save_to_sent")
+	}
+
+	return profile
+}
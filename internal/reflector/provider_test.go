@@ -0,0 +1,33 @@
+package reflector
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestActiveProfile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("provider", "Strato")
+	profile := activeProfile()
+	if profile.SentFolders[0] != "Gesendete Objekte" {
+		t.Errorf("unexpected first Sent folder for strato: %q", profile.SentFolders[0])
+	}
+
+	viper.Set("provider", "gmail")
+	if activeProfile().SaveToSent {
+		t.Errorf("gmail profile should not save to Sent")
+	}
+
+	// Explicit configuration wins over the profile
+	viper.Set("imap.save_to_sent", true)
+	if !activeProfile().SaveToSent {
+		t.Errorf("explicit imap.save_to_sent should override the profile")
+	}
+
+	viper.Set("provider", "unknown-provider")
+	if got := activeProfile().SentFolders; len(got) != len(defaultSentFolders) {
+		t.Errorf("unknown provider should fall back to generic, got %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+package reflector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// smtpLimiter is the token bucket enforcing `smtp.rate_limit`, shared by all forwards of the
+// process. It is rebuilt when the configured rate changes.
+var (
+	smtpLimiter     *rate.Limiter
+	smtpLimiterRate int
+	smtpLimiterMu   sync.Mutex
+)
+
+// currentSMTPLimiter returns the limiter for `smtp.rate_limit` (messages per minute), or nil
+// without a limit. A full minute's worth of messages may be sent in a burst.
+func currentSMTPLimiter() *rate.Limiter {
+	perMinute := viper.GetInt("smtp.rate_limit")
+
+	smtpLimiterMu.Lock()
+	defer smtpLimiterMu.Unlock()
+	if perMinute <= 0 {
+		smtpLimiter, smtpLimiterRate = nil, 0
+		return nil
+	}
+	if smtpLimiter == nil || smtpLimiterRate != perMinute {
+		smtpLimiter = rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)
+		smtpLimiterRate = perMinute
+	}
+	return smtpLimiter
+}
+
+// waitForSMTPRateLimit blocks until another message may be sent under `smtp.rate_limit`. It
+// returns an error if ctx is cancelled first.
+func waitForSMTPRateLimit(ctx context.Context) error {
+	limiter := currentSMTPLimiter()
+	if limiter == nil {
+		return nil
+	}
+
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	slog.Info("Delaying forward to stay within smtp.rate_limit", "delay", delay.Round(time.Second), "rate_limit", viper.GetInt("smtp.rate_limit"))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return fmt.Errorf("waiting for smtp.rate_limit: %w", ctx.Err())
+	}
+}
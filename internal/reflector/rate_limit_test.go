@@ -0,0 +1,31 @@
+package reflector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSMTPRateLimit(t *testing.T) {
+	t.Cleanup(func() { currentSMTPLimiter() }) // drops the limiter once the config is reset
+	t.Cleanup(viper.Reset)
+
+	if err := waitForSMTPRateLimit(context.Background()); err != nil {
+		t.Fatalf("expected no limit by default, got %v", err)
+	}
+
+	// A minute's worth of messages goes out at once, the next one has to wait
+	viper.Set("smtp.rate_limit", 2)
+	for range 2 {
+		if err := waitForSMTPRateLimit(context.Background()); err != nil {
+			t.Fatalf("expected the burst to pass, got %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitForSMTPRateLimit(ctx); err == nil {
+		t.Error("expected the wait to end with the cancelled context")
+	}
+}
@@ -0,0 +1,89 @@
+package reflector
+
+import (
+	"errors"
+	"log/slog"
+	"net/mail"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// errNoAllowedRecipients is returned when `recipient_domains` leaves no recipient to forward to
+var errNoAllowedRecipients = errors.New("no recipients left after applying recipient_domains")
+
+// recipientFields holds the addresses of a forward's To, Cc and Bcc headers
+type recipientFields struct {
+	To, Cc, Bcc []string
+}
+
+// dedupe removes duplicate addresses within each field and then drops addresses from lower
+// precedence fields (to > cc > bcc) that already appear in a higher one, so nobody receives
+// the forward twice or shows up both visibly and blind. Addresses compare case-insensitively
+// without their display names; the first spelling is kept.
+func (f recipientFields) dedupe() recipientFields {
+	seen := make(map[string]string) // address -> field it was kept in
+	keep := func(field string, addrs []string) []string {
+		var kept []string
+		for _, a := range addrs {
+			key := recipientKey(a)
+			if prev, ok := seen[key]; ok {
+				if prev != field {
+					slog.Debug("Dropping recipient already addressed in a higher-precedence field", "address", a, "field", field, "kept_in", prev)
+				}
+				continue
+			}
+			seen[key] = field
+			kept = append(kept, a)
+		}
+		return kept
+	}
+
+	return recipientFields{
+		To:  keep("to", f.To),
+		Cc:  keep("cc", f.Cc),
+		Bcc: keep("bcc", f.Bcc),
+	}
+}
+
+// recipientKey returns the bare lower-cased address used to compare recipients
+func recipientKey(recipient string) string {
+	if addr, err := mail.ParseAddress(recipient); err == nil {
+		recipient = addr.Address
+	}
+	return strings.ToLower(strings.TrimSpace(recipient))
+}
+
+// allowedRecipients applies `recipient_domains.allowed` and `recipient_domains.blocked` to the
+// configured recipients, guarding against forwarding to a wrong domain after a config mistake
+func allowedRecipients(recipients []string) []string {
+	return filterRecipientDomains(recipients,
+		viper.GetStringSlice("recipient_domains.allowed"), viper.GetStringSlice("recipient_domains.blocked"))
+}
+
+// filterRecipientDomains drops recipients whose domain matches a blocked pattern and, if there
+// are allowed patterns, those whose domain matches none of them. Patterns may contain `*`
+// wildcards (e.g. `*.example.org`) and match case-insensitively.
+func filterRecipientDomains(recipients, allowed, blocked []string) []string {
+	if len(allowed) == 0 && len(blocked) == 0 {
+		return recipients
+	}
+
+	allow := newPatternMatcher(allowed)
+	block := newPatternMatcher(blocked)
+
+	var kept []string
+	for _, r := range recipients {
+		key := recipientKey(r)
+		_, domain, _ := strings.Cut(key, "@")
+		switch {
+		case block.Match(domain):
+			slog.Warn("Dropping recipient in a blocked domain", "recipient", r, "domain", domain)
+		case len(allowed) > 0 && !allow.Match(domain):
+			slog.Warn("Dropping recipient outside the allowed domains", "recipient", r, "domain", domain)
+		default:
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,50 @@
+package reflector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRecipientFieldsDedupe(t *testing.T) {
+	t.Parallel()
+
+	got := recipientFields{
+		To:  []string{"Jane Doe <jane@example.com>", "jane@example.com"},
+		Cc:  []string{"JANE@example.com", "bob@example.com", "bob@example.com"},
+		Bcc: []string{"jane@example.com", "bob@example.com", "carol@example.com"},
+	}.dedupe()
+
+	if want := []string{"Jane Doe <jane@example.com>"}; !slices.Equal(got.To, want) {
+		t.Errorf("To = %v, want %v", got.To, want)
+	}
+	if want := []string{"bob@example.com"}; !slices.Equal(got.Cc, want) {
+		t.Errorf("Cc = %v, want %v", got.Cc, want)
+	}
+	if want := []string{"carol@example.com"}; !slices.Equal(got.Bcc, want) {
+		t.Errorf("Bcc = %v, want %v", got.Bcc, want)
+	}
+}
+
+func TestFilterRecipientDomains(t *testing.T) {
+	t.Parallel()
+
+	recipients := []string{"Jane <jane@Example.com>", "bob@lists.example.com", "eve@example.net", "carol@typo.exmple.com"}
+
+	tests := []struct {
+		name             string
+		allowed, blocked []string
+		want             []string
+	}{
+		{"no rules", nil, nil, recipients},
+		{"allowlist", []string{"example.com", "*.example.com"}, nil, []string{"Jane <jane@Example.com>", "bob@lists.example.com"}},
+		{"blocklist", nil, []string{"example.net", "*.exmple.com"}, []string{"Jane <jane@Example.com>", "bob@lists.example.com"}},
+		{"blocklist wins", []string{"*example.com"}, []string{"lists.example.com"}, []string{"Jane <jane@Example.com>"}},
+		{"nothing left", []string{"example.org"}, nil, nil},
+	}
+	for _, tt := range tests {
+		got := filterRecipientDomains(recipients, tt.allowed, tt.blocked)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package reflector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// reconcileMargin widens the reconciliation window to cover clock skew and deliveries in flight
+const reconcileMargin = 5 * time.Minute
+
+// syncTracker remembers when the INBOX was last known to be fully processed
+type syncTracker struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// mark records that everything received before ts has been processed
+func (t *syncTracker) mark(ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = ts
+}
+
+// lastSynced returns the time of the last complete sync, or the zero time if there was none
+func (t *syncTracker) lastSynced() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// reconcileMissedMessages runs the full processing criteria (read and unread messages) over mail
+// received since the previous session was last in sync, forwarding anything that has no record
+// in the state store. This covers mail that arrived during a reconnect gap and was read or
+// partially processed in the meantime. It requires `state.file`, as without a record of what was
+// already forwarded, read messages can't be told apart from missed ones.
+func reconcileMissedMessages(ctx context.Context, imapConn *imapConn, since time.Time) error {
+	store := getStateStore()
+	if store == nil {
+		slog.Debug("No state file configured, reconciliation is limited to unread messages")
+		return nil
+	}
+
+	if !forwardingEnabled() {
+		slog.Debug("Forwarding is paused, skipping reconciliation")
+		return nil
+	}
+
+	since = since.Add(-reconcileMargin)
+	slog.Info("Reconciling messages received during reconnect gap", "since", since)
+
+	if _, err := imapConn.selectMailbox("INBOX", searchReadOnly()); err != nil {
+		return fmt.Errorf("failed to select INBOX: %w", err)
+	}
+
+	// SINCE only has day granularity, the exact window is applied on the internal date below
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+
+	filters := viper.GetStringSlice("filter.from")
+	for i, f := range filters {
+		filters[i] = strings.ToLower(f)
+	}
+
+	var candidates []MailSummary
+	err := imapConn.withConn(func(c *client.Client) error {
+		uids, err := uidSearchWithTimeout(c, criteria, defaultIMAPTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to search: %w", err)
+		}
+		uids = imapConn.aboveBaseline(uids)
+		candidates, _, err = fetchMessagesRobustly(c, uids, filters)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := imapConn.selectMailbox("INBOX", false); err != nil {
+		return fmt.Errorf("failed to select INBOX read-write: %w", err)
+	}
+
+	missed := 0
+	batch := newSeenBatch()
+	session := newSMTPSession()
+	defer session.Close()
+	for _, msg := range candidates {
+		if msg.InternalDate.Before(since) || msg.Envelope == nil || msg.Envelope.MessageId == "" {
+			continue
+		}
+
+		switch store.forwardStatus(msg.Envelope.MessageId) {
+		case forwardStatusForwarded, forwardStatusSkipped, forwardStatusGivenUp:
+			continue
+		}
+
+		missed++
+		slog.Info("Forwarding message missed during reconnect gap", "uid", msg.UID, "subject", msg.Envelope.Subject)
+		err := imapConn.withConn(func(c *client.Client) error {
+			return forwardMessage(ctx, c, msg, batch, session)
+		})
+		if err != nil {
+			slog.Error("Error processing message", "uid", msg.UID, "error", err)
+		}
+	}
+
+	err = imapConn.withConn(func(c *client.Client) error {
+		return batch.flush(c)
+	})
+	if err != nil {
+		slog.Error("Failed to mark reconciled messages as seen", "error", err)
+	}
+
+	slog.Info("Reconciliation complete", "candidates", len(candidates), "missed", missed)
+	return nil
+}
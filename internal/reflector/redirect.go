@@ -0,0 +1,24 @@
+package reflector
+
+import (
+	"log/slog"
+
+	"github.com/spf13/viper"
+)
+
+// testSubjectMarker is prepended to the subject of forwards sent in redirect (test) mode
+const testSubjectMarker = "[TEST]"
+
+// redirectAddress returns `forward.redirect_to`. When set, every forward goes only to this
+// address instead of the recipients and the original sender, to verify real delivery of a new
+// configuration without mailing the list.
+func redirectAddress() string {
+	return viper.GetString("forward.redirect_to")
+}
+
+// warnIfRedirecting logs loudly when redirect mode is active
+func warnIfRedirecting() {
+	if redirect := redirectAddress(); redirect != "" {
+		slog.Warn("TEST MODE: forward.redirect_to is set, all forwards go only to this address", "redirect_to", redirect)
+	}
+}
@@ -0,0 +1,82 @@
+package reflector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Per-message outcomes reported in a CheckResult
+const (
+	MessageForwarded = "forwarded"
+	MessageFailed    = "failed"
+	MessageSkipped   = "skipped"
+)
+
+// MessageResult is the outcome of processing a single matching message
+type MessageResult struct {
+	UID       uint32 `json:"uid"`
+	MessageID string `json:"message_id,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// newMessageResult returns a result for mail with its identifying fields filled in
+func newMessageResult(mail MailSummary) MessageResult {
+	result := MessageResult{UID: mail.UID}
+	if mail.Envelope != nil {
+		result.MessageID = mail.Envelope.MessageId
+		result.Subject = mail.Envelope.Subject
+	}
+	return result
+}
+
+// failed marks the result as failed with err as the reason and returns both
+func (r MessageResult) failed(err error) (MessageResult, error) {
+	r.Status, r.Reason = MessageFailed, err.Error()
+	return r, err
+}
+
+// CheckResult summarizes a single check run
+type CheckResult struct {
+	// Paused is set when matching messages were left unseen because forwarding is disabled
+	Paused    bool            `json:"paused,omitempty"`
+	Matched   int             `json:"matched"`
+	Forwarded int             `json:"forwarded"`
+	Failed    int             `json:"failed"`
+	Skipped   int             `json:"skipped"`
+	Messages  []MessageResult `json:"messages,omitempty"`
+}
+
+// add records the outcome of one message and updates the counts
+func (r *CheckResult) add(msg MessageResult) {
+	switch msg.Status {
+	case MessageForwarded:
+		r.Forwarded++
+	case MessageSkipped:
+		r.Skipped++
+	default:
+		r.Failed++
+	}
+	r.Messages = append(r.Messages, msg)
+}
+
+// String formats the result for the command line
+func (r *CheckResult) String() string {
+	if r.Paused {
+		return fmt.Sprintf("Forwarding is paused (enabled: false), leaving %d matching mails unseen.", r.Matched)
+	}
+	if r.Matched == 0 {
+		return "No matching mails to forward."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d matching mails: %d forwarded, %d failed, %d skipped", r.Matched, r.Forwarded, r.Failed, r.Skipped)
+	for _, msg := range r.Messages {
+		fmt.Fprintf(&b, "\n  [%s] uid %d %q", msg.Status, msg.UID, msg.Subject)
+		if msg.Reason != "" {
+			fmt.Fprintf(&b, ": %s", msg.Reason)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package reflector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestCheckResult(t *testing.T) {
+	t.Parallel()
+
+	result := &CheckResult{Matched: 3}
+	if !strings.Contains(result.String(), "3 matching mails") {
+		t.Errorf("unexpected summary %q", result)
+	}
+
+	mail := MailSummary{UID: 7, Envelope: &imap.Envelope{MessageId: "<a@example.com>", Subject: "Hello"}}
+	forwarded := newMessageResult(mail)
+	forwarded.Status = MessageForwarded
+	result.add(forwarded)
+
+	failed, err := newMessageResult(mail).failed(errors.New("smtp down"))
+	if err == nil || failed.Status != MessageFailed || failed.Reason != "smtp down" {
+		t.Errorf("failed() = %+v, %v", failed, err)
+	}
+	result.add(failed)
+	result.add(MessageResult{UID: 8, Status: MessageSkipped, Reason: "backlog policy"})
+
+	if result.Forwarded != 1 || result.Failed != 1 || result.Skipped != 1 || len(result.Messages) != 3 {
+		t.Errorf("unexpected counts %+v", result)
+	}
+	if result.Messages[0].MessageID != "<a@example.com>" || result.Messages[0].Subject != "Hello" {
+		t.Errorf("message fields not filled in: %+v", result.Messages[0])
+	}
+	if s := result.String(); !strings.Contains(s, "1 forwarded, 1 failed, 1 skipped") || !strings.Contains(s, "smtp down") {
+		t.Errorf("unexpected summary %q", s)
+	}
+
+	if s := (&CheckResult{}).String(); s != "No matching mails to forward." {
+		t.Errorf("unexpected empty summary %q", s)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
 )
 
 const (
@@ -33,40 +36,41 @@ func IsSentFolderUnsupported(err error) bool {
 	return ok
 }
 
-// saveToSent uploads the given raw message to the IMAP "Sent" folder
-func saveToSent(imapClient *client.Client, msgBytes []byte) error {
-	// Note: INBOX should already be selected in read-write mode from connectAndLogin
+// sentFolderCache remembers the special-use Sent folder per IMAP connection ("" if there is none),
+// so the full folder list isn't fetched again on every forward
+var (
+	sentFolderCache = make(map[*client.Client]string)
+	sentFolderMu    sync.Mutex
+)
 
-	// List available folders for debugging (only once)
-	mailboxes := make(chan *imap.MailboxInfo, mailboxesChanBufferSize)
-	done := make(chan error, 1)
-	go func() {
-		done <- imapClient.List("", "*", mailboxes)
-	}()
+// lastSentFolder is the folder the previous forward was saved to on the current connection; it
+// is tried first so bursts of forwards don't go through the candidate list every time
+var (
+	lastSentFolder   string
+	lastSentFolderMu sync.Mutex
+)
 
-	var folderNames []string
-	for m := range mailboxes {
-		folderNames = append(folderNames, m.Name)
+// saveToSent uploads the given raw message to the IMAP "Sent" folder
+func saveToSent(imapClient *client.Client, msgBytes []byte) error {
+	// INBOX is expected to be selected read-write (see connectAndLogin); make sure that's
+	// still the case after the APPEND, before the message is marked as seen
+	defer restoreSourceMailbox(imapClient)
+
+	profile := activeProfile()
+
+	// Prefer the folder the server flags as \Sent, if the provider exposes special-use attributes
+	var specialUseSent string
+	if profile.PreferSpecialUse {
+		specialUseSent = specialUseSentFolder(imapClient)
+	} else if viper.GetBool("verbose") {
+		_ = specialUseSentFolder(imapClient) // lists the folders for debugging once per connection
 	}
-
-	if err := <-done; err != nil {
-		slog.Debug("Could not list folders for debugging", "error", err)
-	} else {
-		slog.Debug("Available IMAP folders", "folders", folderNames)
+	if specialUseSent != "" {
+		slog.Debug("Found special-use Sent folder", "folder", specialUseSent)
 	}
 
-	// Try common Sent folder names (including German providers like Strato)
-	sentFolders := []string{
-		"Sent Items",
-		"Sent Messages",
-		"Sent",
-		"Gesendet",
-		"Gesendete Elemente",
-		"Gesendete Objekte",
-		"INBOX.Sent",
-		"INBOX.Sent Items",
-		"INBOX.Gesendet",
-	}
+	cached := cachedSentFolder()
+	sentFolders := sentFolderCandidates(profile.SentFolders, specialUseSent)
 
 	flags := []string{imap.SeenFlag}
 	date := time.Now()
@@ -77,6 +81,17 @@ func saveToSent(imapClient *client.Client, msgBytes []byte) error {
 		if err != nil {
 			lastErr = err
 			slog.Debug("Failed to append to folder", "folder", folder, "error", err)
+			// The cached special-use folder is gone (e.g. renamed); list the folders again next time
+			if folder == specialUseSent && isNoSuchMailboxError(err) {
+				forgetSentFolder(imapClient)
+			}
+			if folder == cached && cached != "" {
+				resetSentFolderCache()
+			}
+			// The server dropped the connection; no other folder can be tried on it
+			if isConnectionClosed(imapClient) || isConnectionFatalError(err) {
+				return fmt.Errorf("IMAP connection closed during append to %q: %w", folder, err)
+			}
 			// If this is not a "no such mailbox" error, it might be the continuation issue
 			if !isNoSuchMailboxError(err) {
 				// For continuation request issues, suppress the warning and fail gracefully
@@ -89,7 +104,9 @@ func saveToSent(imapClient *client.Client, msgBytes []byte) error {
 			continue
 		}
 
-		slog.Debug("Successfully saved to Sent folder", "folder", folder)
+		setCachedSentFolder(folder)
+		slog.Debug("Successfully saved to Sent folder", "folder", folder,
+			"hint", "set imap.sent_folders to use this folder directly")
 		return nil
 	}
 
@@ -99,6 +116,112 @@ func saveToSent(imapClient *client.Client, msgBytes []byte) error {
 	return fmt.Errorf("failed to append to any Sent folder: no folders were tried")
 }
 
+// sentFolderCandidates returns the folders to try for saving a forward, in order: the folder
+// the previous forward was saved to, the folders configured in `imap.sent_folders`, the server's
+// special-use Sent folder (if found) and the names known for the provider
+func sentFolderCandidates(builtin []string, specialUse string) []string {
+	var folders []string
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && !slices.Contains(folders, name) {
+				folders = append(folders, name)
+			}
+		}
+	}
+	add(cachedSentFolder())
+	add(viper.GetStringSlice("imap.sent_folders")...)
+	add(specialUse)
+	add(builtin...)
+	return folders
+}
+
+// sourceMailbox is the mailbox messages are forwarded from
+const sourceMailbox = "INBOX"
+
+// restoreSourceMailbox re-selects the source mailbox read-write. Some servers shift the
+// connection state around an APPEND to another folder, which would make the following
+// STORE of the \Seen flag operate on the wrong mailbox or fail in read-only mode.
+func restoreSourceMailbox(imapClient *client.Client) {
+	if isConnectionClosed(imapClient) {
+		return
+	}
+
+	status, err := imapClient.Select(sourceMailbox, false)
+	if err != nil {
+		slog.Warn("Could not re-select source mailbox after saving to Sent", "mailbox", sourceMailbox, "error", err)
+		return
+	}
+	setCurrentMailboxStatus(status)
+	slog.Debug("Re-selected source mailbox after saving to Sent", "mailbox", sourceMailbox)
+}
+
+// specialUseSentFolder returns the folder flagged as \Sent on this connection, listing the
+// folders only on first use. The full folder list is logged when verbose logging is enabled.
+func specialUseSentFolder(imapClient *client.Client) string {
+	sentFolderMu.Lock()
+	defer sentFolderMu.Unlock()
+
+	if name, ok := sentFolderCache[imapClient]; ok {
+		return name
+	}
+
+	// Drop entries of connections that have been closed since
+	for c := range sentFolderCache {
+		if isConnectionClosed(c) {
+			delete(sentFolderCache, c)
+		}
+	}
+
+	mailboxes, err := listMailboxes(imapClient)
+	if err != nil {
+		// Don't cache a failed listing, it is retried on the next forward
+		slog.Debug("Could not list folders", "error", err)
+		return ""
+	}
+
+	var folderNames []string
+	var specialUseSent string
+	for _, m := range mailboxes {
+		folderNames = append(folderNames, m.Name)
+		if specialUseSent == "" && slices.Contains(m.Attributes, imap.SentAttr) {
+			specialUseSent = m.Name
+		}
+	}
+
+	if viper.GetBool("verbose") {
+		slog.Debug("Available IMAP folders", "folders", folderNames)
+	}
+
+	sentFolderCache[imapClient] = specialUseSent
+	return specialUseSent
+}
+
+// forgetSentFolder drops the cached folder information of a connection
+func forgetSentFolder(imapClient *client.Client) {
+	sentFolderMu.Lock()
+	defer sentFolderMu.Unlock()
+	delete(sentFolderCache, imapClient)
+}
+
+// cachedSentFolder returns the folder the last forward was saved to, or "" if unknown
+func cachedSentFolder() string {
+	lastSentFolderMu.Lock()
+	defer lastSentFolderMu.Unlock()
+	return lastSentFolder
+}
+
+// setCachedSentFolder remembers the folder a forward was successfully saved to
+func setCachedSentFolder(folder string) {
+	lastSentFolderMu.Lock()
+	defer lastSentFolderMu.Unlock()
+	lastSentFolder = folder
+}
+
+// resetSentFolderCache forgets the remembered Sent folder, e.g. after reconnecting
+func resetSentFolderCache() {
+	setCachedSentFolder("")
+}
+
 // isNoSuchMailboxError checks if the error indicates a mailbox doesn't exist
 func isNoSuchMailboxError(err error) bool {
 	errorStr := strings.ToLower(err.Error())
@@ -0,0 +1,96 @@
+package reflector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestSaveToSentRestoresSourceMailbox(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	c := newTestIMAPClient(t)
+
+	if err := c.Create("Sent"); err != nil {
+		t.Fatalf("failed to create Sent folder: %v", err)
+	}
+
+	// Simulate the state drift: the connection ends up on another mailbox in read-only mode
+	if _, err := c.Select("Sent", true); err != nil {
+		t.Fatalf("failed to examine Sent: %v", err)
+	}
+
+	msg := "From: board@example.org\r\nSubject: Forward\r\n\r\nHello"
+	if err := saveToSent(c, []byte(msg)); err != nil {
+		t.Fatalf("saveToSent failed: %v", err)
+	}
+
+	mbox := c.Mailbox()
+	if mbox == nil || mbox.Name != "INBOX" || mbox.ReadOnly {
+		t.Fatalf("expected INBOX to be selected read-write after saving to Sent, got %+v", mbox)
+	}
+
+	// Marking the forwarded message as seen must work on the restored state
+	if err := markAsSeen(c, 6); err != nil {
+		t.Fatalf("markAsSeen after saveToSent failed: %v", err)
+	}
+
+	status, err := c.Status("Sent", []imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		t.Fatalf("failed to get Sent status: %v", err)
+	}
+	if status.Messages != 1 {
+		t.Errorf("expected the forward in Sent, got %d messages", status.Messages)
+	}
+}
+
+func TestListMailboxes(t *testing.T) {
+	c := newTestIMAPClient(t)
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+
+	mailboxes, err := listMailboxes(c)
+	if err != nil {
+		t.Fatalf("listMailboxes failed: %v", err)
+	}
+
+	var names []string
+	for _, m := range mailboxes {
+		names = append(names, m.Name)
+	}
+	if !slices.Contains(names, "INBOX") || !slices.Contains(names, "Archive") {
+		t.Errorf("expected INBOX and Archive, got %v", names)
+	}
+}
+
+func TestSentFolderCandidates(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetSentFolderCache()
+	t.Cleanup(resetSentFolderCache)
+
+	builtin := []string{"Sent", "Gesendet"}
+	if got := sentFolderCandidates(builtin, ""); !slices.Equal(got, builtin) {
+		t.Errorf("expected the built-in list by default, got %v", got)
+	}
+
+	viper.Set("imap.sent_folders", []string{"Envoyés", "Sent"})
+	got := sentFolderCandidates(builtin, "Sent Items")
+	want := []string{"Envoyés", "Sent", "Sent Items", "Gesendet"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sentFolderCandidates = %v, want %v", got, want)
+	}
+
+	// The folder that worked last is tried first until the cache is reset on reconnect
+	setCachedSentFolder("Gesendet")
+	got = sentFolderCandidates(builtin, "Sent Items")
+	want = []string{"Gesendet", "Envoyés", "Sent", "Sent Items"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sentFolderCandidates with cache = %v, want %v", got, want)
+	}
+	resetSentFolderCache()
+	if got := sentFolderCandidates(builtin, ""); got[0] != "Envoyés" {
+		t.Errorf("reset cache should not be tried first, got %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package reflector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// defaultScanTimeout limits how long scanning a single attachment may take
+const defaultScanTimeout = 30 * time.Second
+
+// clamdChunkSize is the size of the chunks streamed to clamd
+const clamdChunkSize = 64 * 1024
+
+// Policies for messages with an attachment that failed the scan (`scan.policy`)
+const (
+	scanStrip      = "strip"      // forward the message without the flagged attachments (default)
+	scanSkip       = "skip"       // don't forward the message, only mark it as seen
+	scanQuarantine = "quarantine" // copy the message to `scan.quarantine_folder` and mark it as seen
+)
+
+// errScanPositive is returned by scanners for content they flag as malicious
+var errScanPositive = errors.New("attachment flagged by scanner")
+
+// scanningEnabled reports whether attachments are scanned before forwarding
+func scanningEnabled() bool {
+	return len(viper.GetStringSlice("hooks.scan_attachment")) > 0 || viper.GetString("scan.clamav_addr") != ""
+}
+
+// scanPolicy returns the configured `scan.policy`
+func scanPolicy() string {
+	switch policy := viper.GetString("scan.policy"); policy {
+	case scanSkip, scanQuarantine:
+		return policy
+	default:
+		return scanStrip
+	}
+}
+
+// scanTimeout returns the configured `scan.timeout`
+func scanTimeout() time.Duration {
+	if viper.IsSet("scan.timeout") {
+		return viper.GetDuration("scan.timeout")
+	}
+	return defaultScanTimeout
+}
+
+// scanAttachment runs the configured scanners over one attachment. It returns errScanPositive
+// (wrapped with the finding) when the attachment is flagged. Scanner errors are returned as
+// they are, unless `scan.fail_open` is set, in which case they are logged and ignored.
+func scanAttachment(filename, contentType string, data []byte) error {
+	err := runScanners(filename, contentType, data)
+	if err != nil && !errors.Is(err, errScanPositive) && viper.GetBool("scan.fail_open") {
+		slog.Warn("Attachment scan failed, forwarding it anyway (scan.fail_open)", "filename", filename, "error", err)
+		return nil
+	}
+	return err
+}
+
+// runScanners runs the scan hook and clamd, whichever are configured
+func runScanners(filename, contentType string, data []byte) error {
+	if args := viper.GetStringSlice("hooks.scan_attachment"); len(args) > 0 {
+		if err := execScanHook(args, filename, contentType, data, scanTimeout()); err != nil {
+			return err
+		}
+	}
+	if addr := viper.GetString("scan.clamav_addr"); addr != "" {
+		if err := clamdScan(addr, data, scanTimeout()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execScanHook passes the attachment on stdin to the `hooks.scan_attachment` command. Exit
+// status 0 means clean, 1 means flagged, anything else is a scanner error.
+func execScanHook(args []string, filename, contentType string, data []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"MAIL_REFLECTOR_FILENAME="+filename,
+		"MAIL_REFLECTOR_CONTENT_TYPE="+contentType,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("scan hook timed out after %v", timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return fmt.Errorf("%w: %s", errScanPositive, bytes.TrimSpace(output))
+	}
+	if err != nil {
+		return fmt.Errorf("scan hook failed: %w (output: %q)", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// clamdScan streams data to a clamd daemon with the INSTREAM command. addr is a host:port
+// or the path of a unix socket.
+func clamdScan(addr string, data []byte, timeout time.Duration) error {
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to clamd at %s: %w", addr, err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	w := bufio.NewWriter(conn)
+	_, _ = w.WriteString("zINSTREAM\x00")
+	for len(data) > 0 {
+		chunk := data[:min(len(data), clamdChunkSize)]
+		data = data[len(chunk):]
+		_ = binary.Write(w, binary.BigEndian, uint32(len(chunk)))
+		_, _ = w.Write(chunk)
+	}
+	_ = binary.Write(w, binary.BigEndian, uint32(0))
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to send attachment to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), "\x00"))
+
+	switch {
+	case reply == "OK":
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return fmt.Errorf("%w: %s", errScanPositive, strings.TrimSuffix(reply, " FOUND"))
+	default:
+		return fmt.Errorf("clamd error: %s", reply)
+	}
+}
+
+// applyAttachmentScan scans the attachments and inline images of mail. Flagged parts are
+// removed under the strip policy, and the message is forwarded without them. Under the skip
+// and quarantine policies it returns false and the reason, and the message must not be
+// forwarded. Scanner errors count as flagged unless `scan.fail_open` is set.
+func applyAttachmentScan(mail MailSummary) (MailSummary, bool, string) {
+	if !scanningEnabled() {
+		return mail, true, ""
+	}
+
+	var findings []string
+	var attachments []Attachment
+	for _, att := range mail.Attachments {
+		if err := scanAttachment(att.Filename, att.ContentType, att.Data); err != nil {
+			findings = append(findings, fmt.Sprintf("%s (%v)", att.Filename, err))
+			continue
+		}
+		attachments = append(attachments, att)
+	}
+	var images []InlineImage
+	for _, img := range mail.InlineImages {
+		if err := scanAttachment(img.Filename, img.ContentType, img.Data); err != nil {
+			findings = append(findings, fmt.Sprintf("%s (%v)", img.Filename, err))
+			continue
+		}
+		images = append(images, img)
+	}
+
+	if len(findings) == 0 {
+		return mail, true, ""
+	}
+
+	policy := scanPolicy()
+	slog.Warn("Attachment scan flagged message", "uid", mail.UID, "policy", policy, "findings", findings)
+	if policy != scanStrip {
+		return mail, false, "attachment scan: " + strings.Join(findings, ", ")
+	}
+
+	mail.Attachments = attachments
+	mail.InlineImages = images
+	mail.TextBody = strings.TrimRight(mail.TextBody, "\r\n") +
+		"\n\n[Attachments removed by the virus scan: " + strings.Join(findings, ", ") + "]\n"
+	mail.Raw = nil // the original MIME structure still contains the flagged parts
+	return mail, true, ""
+}
+
+// quarantineMessage copies a flagged message to `scan.quarantine_folder`, if configured
+func quarantineMessage(c *client.Client, uid uint32) error {
+	folder := viper.GetString("scan.quarantine_folder")
+	if scanPolicy() != scanQuarantine || folder == "" {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	if err := c.UidCopy(seqset, folder); err != nil {
+		return fmt.Errorf("failed to copy message to %s: %w", folder, err)
+	}
+	slog.Info("Quarantined message", "uid", uid, "folder", folder)
+	return nil
+}
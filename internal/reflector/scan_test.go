@@ -0,0 +1,114 @@
+package reflector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// fakeClamd answers INSTREAM requests, flagging streams that contain "EICAR"
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var data []byte
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					chunk := make([]byte, size)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					data = append(data, chunk...)
+				}
+				reply := "stream: OK\x00"
+				if bytes.Contains(data, []byte("EICAR")) {
+					reply = "stream: Eicar-Test-Signature FOUND\x00"
+				}
+				_, _ = conn.Write([]byte(reply))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestClamdScan(t *testing.T) {
+	t.Parallel()
+
+	addr := fakeClamd(t)
+	if err := clamdScan(addr, bytes.Repeat([]byte("clean"), 20000), time.Second); err != nil {
+		t.Errorf("expected a clean result, got %v", err)
+	}
+	err := clamdScan(addr, []byte("X5O!P%@AP EICAR"), time.Second)
+	if !errors.Is(err, errScanPositive) || !strings.Contains(err.Error(), "Eicar-Test-Signature") {
+		t.Errorf("expected the stream to be flagged, got %v", err)
+	}
+}
+
+func TestApplyAttachmentScan(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("hooks.scan_attachment", []string{"sh", "-c", "! grep -q EICAR"})
+	mail := MailSummary{
+		TextBody: "See attached.\n",
+		Attachments: []Attachment{
+			{Filename: "agenda.pdf", Data: []byte("%PDF")},
+			{Filename: "invoice.exe", Data: []byte("EICAR")},
+		},
+		Raw: []byte("original"),
+	}
+
+	stripped, ok, _ := applyAttachmentScan(mail)
+	if !ok || len(stripped.Attachments) != 1 || stripped.Attachments[0].Filename != "agenda.pdf" {
+		t.Fatalf("expected the flagged attachment to be stripped, got %+v", stripped.Attachments)
+	}
+	if !strings.Contains(stripped.TextBody, "invoice.exe") || stripped.Raw != nil {
+		t.Errorf("expected a note about the removed attachment, got %q", stripped.TextBody)
+	}
+
+	viper.Set("scan.policy", "skip")
+	if _, ok, reason := applyAttachmentScan(mail); ok || !strings.Contains(reason, "invoice.exe") {
+		t.Errorf("expected the message to be skipped, got %v, %q", ok, reason)
+	}
+
+	// Scanner errors fail closed unless scan.fail_open is set
+	viper.Set("hooks.scan_attachment", []string{"sh", "-c", "exit 2"})
+	if _, ok, _ := applyAttachmentScan(mail); ok {
+		t.Error("expected a scanner error to block the message")
+	}
+	viper.Set("scan.fail_open", true)
+	if _, ok, _ := applyAttachmentScan(mail); !ok {
+		t.Error("expected scan.fail_open to forward the message")
+	}
+}
@@ -0,0 +1,55 @@
+package reflector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+)
+
+// parseSchedule parses a `serve.schedule` cron expression: five fields (minute, hour, day of
+// month, month, day of week) or a descriptor such as `@hourly` or `@every 30m`
+func parseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serve.schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// startSchedule triggers a processing run on every tick of `serve.schedule`, in addition to
+// IDLE notifications, until ctx is cancelled. Without a schedule the returned channel is nil,
+// so receiving from it blocks forever.
+func startSchedule(ctx context.Context) (<-chan struct{}, error) {
+	spec := viper.GetString("serve.schedule")
+	if spec == "" {
+		return nil, nil
+	}
+
+	schedule, err := parseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ticks arriving while a run is still pending are dropped
+	ticks := make(chan struct{}, 1)
+	scheduler := cron.New()
+	scheduler.Schedule(schedule, cron.FuncJob(func() {
+		select {
+		case ticks <- struct{}{}:
+		default:
+		}
+	}))
+	scheduler.Start()
+	slog.Info("Scheduled processing enabled", "schedule", spec)
+
+	go func() {
+		<-ctx.Done()
+		<-scheduler.Stop().Done()
+		slog.Debug("Scheduler stopped")
+	}()
+
+	return ticks, nil
+}
@@ -0,0 +1,79 @@
+package reflector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+
+	schedule, err := parseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	from := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+	if next := schedule.Next(from); !next.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the next run on the hour, got %v", next)
+	}
+
+	for _, spec := range []string{"@hourly", "@every 30m", "*/15 8-18 * * 1-5"} {
+		if _, err := parseSchedule(spec); err != nil {
+			t.Errorf("parseSchedule(%q) failed: %v", spec, err)
+		}
+	}
+	if _, err := parseSchedule("every hour"); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
+
+func TestStartScheduleDisabled(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	ticks, err := startSchedule(context.Background())
+	if err != nil || ticks != nil {
+		t.Errorf("expected no schedule without serve.schedule, got %v, %v", ticks, err)
+	}
+
+	viper.Set("serve.schedule", "not a schedule")
+	if _, err := startSchedule(context.Background()); err == nil {
+		t.Error("expected an error for an invalid schedule")
+	}
+}
+
+func TestPollModeConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if serveMode() != serveModeIdle || pollInterval() != defaultPollInterval {
+		t.Errorf("expected idle mode with the default interval, got %q, %v", serveMode(), pollInterval())
+	}
+
+	viper.Set("serve.mode", "poll")
+	viper.Set("serve.poll_interval", "2m")
+	if serveMode() != serveModePoll || pollInterval() != 2*time.Minute {
+		t.Errorf("expected poll mode every 2m, got %q, %v", serveMode(), pollInterval())
+	}
+
+	viper.Set("serve.poll_interval", "1s")
+	if pollInterval() != 10*time.Second {
+		t.Errorf("expected the interval to be clamped to 10s, got %v", pollInterval())
+	}
+}
+
+func TestWaitInterMessageDelay(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if !waitInterMessageDelay(context.Background()) {
+		t.Error("expected no wait without forward.inter_message_delay")
+	}
+
+	viper.Set("forward.inter_message_delay", "1h")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if waitInterMessageDelay(ctx) {
+		t.Error("expected the delay to end early when the context is cancelled")
+	}
+}
@@ -2,10 +2,12 @@ package reflector
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/emersion/go-imap/client"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -13,7 +15,36 @@ import (
 // When a new message arrives, it triggers the same logic as the `check` command.
 func Serve(ctx context.Context) error {
 	connectionAttempt := 0
+	warnIfRedirecting()
 
+	// Tracks the last complete sync so mail arriving during reconnect gaps can be reconciled
+	synced := &syncTracker{}
+
+	// With the ignore_existing backlog policy, only mail above the startup UID is forwarded
+	baseline := &uidBaseline{}
+
+	// Optional cron schedule triggering runs independently of IDLE notifications
+	scheduled, err := startSchedule(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Optional periodic summary notifications
+	startSummaries(ctx)
+
+	// Messages left unseen while forwarding was paused are processed as soon as it's re-enabled
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		// Reloading drops the account's settings merged over the shared ones
+		if err := applySelectedAccount(); err != nil {
+			slog.Error("Failed to re-apply account settings after config change", "error", err)
+		}
+		slog.Info("Config file changed, reloaded", "file", e.Name, "enabled", forwardingEnabled())
+		if forwardingEnabled() {
+			signalResumed()
+		}
+	})
+
+reconnectLoop:
 	for {
 		// Check for cancellation at the start of each connection attempt
 		select {
@@ -27,6 +58,7 @@ func Serve(ctx context.Context) error {
 		slog.Info("Connecting to IMAP server", "attempt", connectionAttempt)
 
 		rawClient, err := connectAndLogin()
+		recordConnectAttempt(err)
 		if err != nil {
 			slog.Error("Failed to connect", "error", err, "attempt", connectionAttempt)
 
@@ -47,73 +79,211 @@ func Serve(ctx context.Context) error {
 
 		// Create managed IMAP connection wrapper
 		imapConn := newImapConn(rawClient)
+		baseline.apply(imapConn)
+		resetSentFolderCache()
 
 		// Reset connection attempt counter on successful connection
 		connectionAttempt = 0
 
-		// Check for existing unread messages before entering IDLE
-		slog.Info("Checking for existing unread messages")
-		err = processMessagesWithConn(imapConn, "initial check")
-		if err != nil {
-			slog.Error("Error processing messages", "context", "initial check", "error", err)
+		// Check for existing unread messages before entering IDLE. The backlog policy only
+		// applies on the first connection; after a reconnect, mail received in the gap is
+		// forwarded and reconciled against the state store.
+		gapStart := synced.lastSynced()
+		isBacklog := gapStart.IsZero()
+		checkContext := "initial check"
+		if !isBacklog {
+			checkContext = "reconnect"
 		}
 
-		// Setup IDLE mode with proper updates channel (buffered to prevent deadlock)
-		updates := make(chan client.Update, 64) // buffer to allow IDLE goroutine to send final updates
-		imapConn.c.Updates = updates
-
-		// Start IDLE
-		err = imapConn.startIdle()
+		slog.Info("Checking for existing unread messages", "context", checkContext)
+		checkStarted := time.Now()
+		err = processMessagesWithConn(ctx, imapConn, checkContext, isBacklog)
 		if err != nil {
-			slog.Error("Failed to start IDLE", "error", err)
+			slog.Error("Error processing messages", "context", checkContext, "error", err)
+		} else if !isBacklog {
+			err = reconcileMissedMessages(ctx, imapConn, gapStart)
+			if err != nil {
+				slog.Error("Reconciliation after reconnect failed", "error", err)
+			}
+		}
+		if err == nil {
+			synced.mark(checkStarted)
+			recordCheck(checkStarted)
+		}
+
+		if reason := imapConn.reconnectReason(); reason != "" {
+			slog.Warn("Recycling IMAP connection", "reason", reason)
 			_ = imapConn.close()
 			continue
 		}
 
+		// In poll mode the mailbox is checked on a timer instead of waiting for IDLE updates
+		pollMode := serveMode() == serveModePoll
+		var updates chan client.Update // stays nil (never ready) in poll mode
+		var poll <-chan time.Time
+		if pollMode {
+			slog.Info("Polling for new messages", "interval", pollInterval())
+			poll = time.After(pollInterval())
+		} else {
+			// Setup IDLE mode with proper updates channel (buffered to prevent deadlock)
+			updatesBuffer := defaultUpdatesBuffer
+			if viper.IsSet("serve.updates_buffer") {
+				updatesBuffer = max(viper.GetInt("serve.updates_buffer"), 1)
+			}
+			updates = make(chan client.Update, updatesBuffer) // buffer to allow IDLE goroutine to send final updates
+			imapConn.c.Updates = updates
+
+			// Start IDLE
+			err = imapConn.startIdle()
+			if err != nil {
+				slog.Error("Failed to start IDLE", "error", err)
+				_ = imapConn.close()
+				continue
+			}
+		}
+
 		// Monitor for updates, cancellation, or errors
 		// Use a single-flight worker to serialize processing and keep updates reader responsive
-		work := make(chan struct{}, 1)
+		worker := &updateCoalescer{}
+
+		// The worker requests a fresh connection here when the current one looks unhealthy
+		reconnect := make(chan string, 1)
+
+		// Dispatch processing to background goroutine to keep updates reader responsive
+		dispatch := func(context string) {
+			if !worker.trigger() {
+				// Already processing; coalesce this update into one more run afterwards
+				slog.Debug("Processing already in progress, queueing another run for this update")
+				return
+			}
+
+			go func() {
+				for {
+					started := time.Now()
+					if err := processMessagesWithConn(ctx, imapConn, context, false); err != nil {
+						slog.Error("Error processing new messages", "context", context, "error", err)
+					} else {
+						synced.mark(started)
+						recordCheck(started)
+					}
+
+					if !worker.finish() {
+						break
+					}
+					context = "coalesced updates"
+				}
+
+				// Hand over to the reconnect path instead of resuming IDLE on a suspect connection
+				if reason := imapConn.reconnectReason(); reason != "" {
+					select {
+					case reconnect <- reason:
+					default: // a reconnect is already pending
+					}
+					return
+				}
+
+				// Resume IDLE from an accurate mailbox state, so the next update isn't evaluated
+				// against counts that processing has made stale
+				if refreshAfterProcessing() {
+					if err := imapConn.refreshStatus(); err != nil {
+						slog.Warn("Could not refresh mailbox status after processing", "error", err)
+					}
+				}
+
+				if pollMode {
+					return
+				}
+
+				// Restart IDLE after processing messages
+				if err := imapConn.startIdle(); err != nil {
+					slog.Error("Failed to restart IDLE after processing", "error", err)
+					// Note: In goroutine, can't use goto reconnect directly
+					// The connection will be handled by the next update or timeout
+				}
+			}()
+		}
+
+		// Optionally recycle the connection after `serve.max_connection_lifetime`, even if healthy,
+		// as long-lived sessions accumulate server-side state and occasionally degrade
+		var expired <-chan time.Time
+		if lifetime := viper.GetDuration("serve.max_connection_lifetime"); lifetime > 0 {
+			expired = time.After(lifetime)
+		}
 
 		for {
 			select {
+			case <-expired:
+				// Claim the worker so no processing is interrupted or started during the switch
+				if worker.tryStart() {
+					slog.Info("Maximum connection lifetime reached, reconnecting")
+					_ = imapConn.close()
+					continue reconnectLoop
+				}
+				slog.Debug("Maximum connection lifetime reached, waiting for processing to finish")
+				expired = time.After(5 * time.Second)
 			case <-ctx.Done():
 				slog.Info("Serve operation cancelled, shutting down IDLE")
 				_ = imapConn.close()
 				return nil
+			case reason := <-reconnect:
+				slog.Warn("Recycling IMAP connection", "reason", reason)
+				_ = imapConn.close()
+				continue reconnectLoop
+			case <-scheduled:
+				slog.Info("Scheduled check")
+				dispatch("scheduled")
+			case <-poll:
+				slog.Debug("Polling for new messages")
+				dispatch("poll")
+				poll = time.After(pollInterval())
+			case <-resumeSignal:
+				slog.Info("Forwarding enabled, processing pending messages")
+				dispatch("resumed")
 			case update := <-updates:
 				if u, ok := update.(*client.MailboxUpdate); ok {
 					slog.Info("New mail detected", "exists", u.Mailbox.Messages, "recent", u.Mailbox.Recent)
-
-					// Dispatch processing to background goroutine to keep updates reader responsive
-					select {
-					case work <- struct{}{}: // only process if not already processing
-						go func() {
-							defer func() { <-work }() // release work token when done
-
-							if err := processMessagesWithConn(imapConn, "new mail"); err != nil {
-								slog.Error("Error processing new messages", "error", err)
-							}
-
-							// Restart IDLE after processing messages
-							if err := imapConn.startIdle(); err != nil {
-								slog.Error("Failed to restart IDLE after processing", "error", err)
-								// Note: In goroutine, can't use goto reconnect directly
-								// The connection will be handled by the next update or timeout
-							}
-						}()
-					default:
-						// Already processing; skip this update to avoid overwhelming the system
-						slog.Debug("Skipping duplicate mail update - processing already in progress")
-					}
+					dispatch("new mail")
 				}
 			}
 		}
 	}
 }
 
-// processMessagesWithConn fetches and forwards matching messages using imapConn wrapper
-func processMessagesWithConn(imapConn *imapConn, context string) error {
-	slog.Debug("Processing messages started", "context", context)
+// Serve modes selecting how new mail is noticed (`serve.mode`)
+const (
+	serveModeIdle = "idle" // wait for IMAP IDLE notifications (default)
+	serveModePoll = "poll" // check every `serve.poll_interval`, for servers with unreliable IDLE
+)
+
+// defaultPollInterval is used in poll mode when `serve.poll_interval` isn't set
+const defaultPollInterval = 5 * time.Minute
+
+// serveMode returns the configured `serve.mode`
+func serveMode() string {
+	if viper.GetString("serve.mode") == serveModePoll {
+		return serveModePoll
+	}
+	return serveModeIdle
+}
+
+// pollInterval returns the configured `serve.poll_interval` (at least 10 seconds)
+func pollInterval() time.Duration {
+	if !viper.IsSet("serve.poll_interval") {
+		return defaultPollInterval
+	}
+	return max(viper.GetDuration("serve.poll_interval"), 10*time.Second)
+}
+
+// refreshAfterProcessing reports whether the mailbox status is refreshed after each processing
+// run (`serve.refresh_after_processing`, enabled by default)
+func refreshAfterProcessing() bool {
+	return !viper.IsSet("serve.refresh_after_processing") || viper.GetBool("serve.refresh_after_processing")
+}
+
+// processMessagesWithConn fetches and forwards matching messages using imapConn wrapper.
+// When isBacklog is set, the configured backlog policy decides which messages are forwarded.
+func processMessagesWithConn(ctx context.Context, imapConn *imapConn, checkContext string, isBacklog bool) error {
+	slog.Debug("Processing messages started", "context", checkContext)
 
 	var messages []MailSummary
 	var err error
@@ -121,18 +291,50 @@ func processMessagesWithConn(imapConn *imapConn, context string) error {
 	// Use the new wrapper-aware function that properly manages IDLE state
 	messages, err = FetchMatchingMailsWithConn(imapConn)
 	if err != nil {
-		slog.Error("Error fetching messages", "context", context, "error", err)
+		slog.Error("Error fetching messages", "context", checkContext, "error", err)
 		return err
 	}
 
 	if len(messages) == 0 {
-		slog.Info("No matching messages found", "context", context)
+		slog.Info("No matching messages found", "context", checkContext)
 		return nil
 	}
 
-	slog.Info("Found matching messages to forward", "context", context, "count", len(messages))
+	slog.Info("Found matching messages to forward", "context", checkContext, "count", len(messages))
+
+	if !forwardingEnabled() {
+		slog.Warn("Forwarding is paused, leaving messages unseen", "context", checkContext, "count", len(messages))
+		return nil
+	}
+
+	// Flags are changed below, which needs a read-write selection after a read-only search
+	if _, err := imapConn.selectMailbox(sourceMailbox, false); err != nil {
+		return fmt.Errorf("failed to select INBOX read-write: %w", err)
+	}
+
+	if isBacklog {
+		var skipped []MailSummary
+		messages, skipped = applyBacklogPolicy(messages)
+
+		for _, msg := range skipped {
+			err = imapConn.withConn(func(c *client.Client) error {
+				return skipBacklogMessage(c, msg)
+			})
+			if err != nil {
+				slog.Warn("Could not mark skipped backlog mail as seen", "uid", msg.UID, "error", err)
+			}
+		}
+	}
+
+	batch := newSeenBatch()
+	session := newSMTPSession()
+	defer session.Close()
+	for i, msg := range messages {
+		if i > 0 && !waitInterMessageDelay(ctx) {
+			slog.Warn("Processing cancelled, leaving remaining messages for the next run", "context", checkContext, "remaining", len(messages)-i)
+			break
+		}
 
-	for _, msg := range messages {
 		if len(msg.Envelope.From) > 0 {
 			recipients := viper.GetStringSlice("recipients")
 			slog.Info("Forwarding message", "from", msg.Envelope.From[0].Address(), "subject", msg.Envelope.Subject, "recipients", recipients, "recipient_count", len(recipients))
@@ -140,17 +342,7 @@ func processMessagesWithConn(imapConn *imapConn, context string) error {
 
 		// Forward and mark as seen using withConn to manage IDLE state
 		err = imapConn.withConn(func(c *client.Client) error {
-			if err := ForwardMail(c, msg); err != nil {
-				slog.Error("Error forwarding mail", "error", err)
-				return err
-			}
-
-			if err := markAsSeen(c, msg.UID); err != nil {
-				slog.Error("Error marking mail as seen", "error", err)
-				return err
-			}
-
-			return nil
+			return forwardMessage(ctx, c, msg, batch, session)
 		})
 		if err != nil {
 			slog.Error("Error processing message", "uid", msg.UID, "error", err)
@@ -158,5 +350,13 @@ func processMessagesWithConn(imapConn *imapConn, context string) error {
 		}
 	}
 
+	// Mark all forwarded messages as seen at once when batching is enabled
+	err = imapConn.withConn(func(c *client.Client) error {
+		return batch.flush(c)
+	})
+	if err != nil {
+		slog.Error("Failed to mark forwarded messages as seen", "context", checkContext, "error", err)
+	}
+
 	return nil
 }
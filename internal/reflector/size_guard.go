@@ -0,0 +1,88 @@
+package reflector
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/spf13/viper"
+)
+
+// Policies for messages exceeding `fetch.max_message_bytes`
+const (
+	fetchOversizeSkip      = "skip"      // leave the message unseen without downloading it (default)
+	fetchOversizeReference = "reference" // forward a short note referencing the original instead
+)
+
+// maxMessageBytes returns the configured `fetch.max_message_bytes` (0 means no limit)
+func maxMessageBytes() int64 {
+	return int64(viper.GetSizeInBytes("fetch.max_message_bytes"))
+}
+
+// guardMessageSize checks the server-reported size of a message before its body is downloaded,
+// so a single giant message can't exhaust memory. It returns handled=false if the message is
+// within the limit and should be fetched normally. Otherwise the message is either skipped
+// (nil summary) or, with `fetch.oversize_policy: reference`, replaced by a reference summary.
+// matched reports whether the header-only filter already matched the message.
+func guardMessageSize(client *client.Client, uid uint32, filters []string, matched bool, limit int64) (*MailSummary, bool, error) {
+	msg, err := fetchMessageMeta(client, uid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(msg.Size) <= limit {
+		return nil, false, nil
+	}
+
+	if !matched && !isMessageMatching(msg.Envelope, filters) {
+		return nil, true, nil
+	}
+
+	policy := viper.GetString("fetch.oversize_policy")
+	if policy != fetchOversizeReference {
+		slog.Warn("Matching message exceeds fetch.max_message_bytes, leaving it unseen",
+			"uid", uid, "size", msg.Size, "limit", limit, "from", getFromAddress(msg.Envelope))
+		return nil, true, nil
+	}
+
+	slog.Warn("Matching message exceeds fetch.max_message_bytes, forwarding a reference",
+		"uid", uid, "size", msg.Size, "limit", limit, "from", getFromAddress(msg.Envelope))
+
+	return &MailSummary{
+		Envelope:     msg.Envelope,
+		UID:          msg.Uid,
+		InternalDate: msg.InternalDate,
+		TextBody: fmt.Sprintf("[This message (%s) was too large to be downloaded and forwarded.]\n"+
+			"[Original: mailbox INBOX, UID %d]\n", formatSize(int(msg.Size)), msg.Uid),
+	}, true, nil
+}
+
+// fetchMessageMeta fetches the envelope, internal date and size of a message without its body
+func fetchMessageMeta(client *client.Client, uid uint32) (*imap.Message, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchInternalDate, imap.FetchRFC822Size}
+	messages := make(chan *imap.Message, 1)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- client.UidFetch(seqset, items, messages) }()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch size of message %d: %w", uid, err)
+		}
+	case <-time.After(defaultIMAPTimeout):
+		return nil, fmt.Errorf("size fetch for message %d timed out after %v", uid, defaultIMAPTimeout)
+	}
+
+	// The fetch has completed, so the channel is closed and holds the message if there was one
+	msg := <-messages
+	if msg == nil {
+		return nil, fmt.Errorf("no message received for UID %d", uid)
+	}
+	return msg, nil
+}
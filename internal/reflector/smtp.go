@@ -2,91 +2,63 @@ package reflector
 
 import (
 	"bytes"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
 
+	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"github.com/spf13/viper"
 	gomail "gopkg.in/gomail.v2"
 )
 
-// ForwardMail sends a new mail based on a matching input message.
+// ForwardMail sends a new mail based on a matching input message, using `from` as the outgoing
+// From address (see resolveFromAddress).
 // It preserves subject, sender info, both plain text and HTML bodies, and includes all attachments.
-func ForwardMail(client *client.Client, original MailSummary) error {
-	// Load SMTP config and recipient list from config
-	smtpServer := viper.GetString("smtp.server")
-	smtpPort := viper.GetInt("smtp.port")
-	smtpUser := viper.GetString("smtp.username")
-	smtpPass := viper.GetString("smtp.password")
-
-	recipients := viper.GetStringSlice("recipients")
-	subjectPrefix := viper.GetString("subject.prefix")
-
-	// Set From to the SMTP identity, and To to the original sender
-	from := smtpUser
-	to := original.Envelope.From[0].Address()
-	reply := original.Envelope.From[0].Address()
-	var subject string
-	if subjectPrefix != "" {
-		subject = fmt.Sprintf("%s %s", subjectPrefix, original.Envelope.Subject)
-	} else {
-		subject = original.Envelope.Subject
-	}
-
-	// Compose the outgoing message
-	msg := gomail.NewMessage()
-	msg.SetHeader("From", from)
-	msg.SetHeader("To", to)
-	msg.SetHeader("Reply-To", reply)
-	msg.SetHeader("Bcc", recipients...)
-	msg.SetHeader("Subject", subject)
-
-	// Set body (text/plain is required, HTML is optional and added as alternative)
-	msg.SetBody("text/plain", original.TextBody)
+// With `forward.mode: to` the recipients are addressed in To instead of Bcc, and with
+// `forward.mode: passthrough` the original MIME structure is resent unchanged instead.
+func ForwardMail(client *client.Client, original MailSummary, from string) error {
+	return forwardMail(client, nil, original, from)
+}
 
-	if original.HTMLBody != "" {
-		msg.AddAlternative("text/html", original.HTMLBody)
+// forwardMail is ForwardMail, sending over session (see smtpSession) when it isn't nil
+func forwardMail(client *client.Client, session *smtpSession, original MailSummary, from string) error {
+	recipients := allowedRecipients(viper.GetStringSlice("recipients"))
+	if len(recipients) == 0 {
+		slog.Warn("Not forwarding, recipient_domains removed all recipients", "uid", original.UID)
+		return errNoAllowedRecipients
 	}
 
-	// Attach each file from the original mail
-	for _, att := range original.Attachments {
-		msg.Attach(att.Filename,
-			// Explicitly set Content-Type to preserve original metadata
-			gomail.SetHeader(map[string][]string{
-				"Content-Type": {att.ContentType},
-			}),
-
-			// Copy the raw data into the attachment
-			gomail.SetCopyFunc(func(w io.Writer) error {
-				_, err := w.Write(att.Data)
-				return err
-			}),
-		)
+	subject := forwardSubject(original)
+	if redirect := redirectAddress(); redirect != "" {
+		slog.Warn("TEST MODE: redirecting forward", "redirect_to", redirect, "recipients", recipients)
+		recipients = []string{redirect}
+		subject = testSubjectMarker + " " + subject
 	}
 
-	// Configure the SMTP dialer
-	dialer := gomail.NewDialer(smtpServer, smtpPort, smtpUser, smtpPass)
-
-	// Enable secure transport if configured
-	if viper.GetString("smtp.security") == "ssl" {
-		dialer.SSL = true
+	var sent io.WriterTo
+	var err error
+	if (forwardMode() == forwardModePassthrough || original.Encrypted) && original.Raw != nil {
+		sent, err = sendPassthrough(session, original, from, subject, recipients)
 	} else {
-		// Fallback for TLS (STARTTLS): optionally skip cert verification
-		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		sent, err = sendComposed(session, original, from, subject, recipients)
 	}
-
-	// Attempt to send the message
-	if err := dialer.DialAndSend(msg); err != nil {
+	if err != nil {
 		slog.Error("Failed to send mail", "error", err, "subject", subject, "to", recipients)
 		return fmt.Errorf("failed to send mail: %w", err)
 	}
 
-	// Save to "Sent" via IMAP
-	if client != nil {
+	// Save to "Sent" via IMAP, unless the provider already does so for SMTP submissions
+	if client != nil && !activeProfile().SaveToSent {
+		slog.Debug("Skipping save to Sent folder", "reason", "disabled_for_provider", "provider", viper.GetString("provider"))
+	} else if client != nil {
 		var buf bytes.Buffer
-		if _, err := msg.WriteTo(&buf); err != nil {
+		if _, err := sent.WriteTo(&buf); err != nil {
 			slog.Error("Failed to serialize message", "error", err)
 			return fmt.Errorf("failed to serialize message: %w", err)
 		}
@@ -108,3 +80,339 @@ func ForwardMail(client *client.Client, original MailSummary) error {
 
 	return nil
 }
+
+// sendComposed recomposes the original's bodies and attachments into a new message and sends it,
+// returning the sent message
+func sendComposed(session *smtpSession, original MailSummary, from, subject string, recipients []string) (io.WriterTo, error) {
+	smtpServer := viper.GetString("smtp.server")
+	smtpPort := viper.GetInt("smtp.port")
+
+	// From is the resolved outgoing identity, and To the original sender
+	to := original.Envelope.From[0].Address()
+	reply := resolveReplyTo(original)
+
+	// Compose the outgoing message, passing 8-bit bodies through only when the server supports it
+	var msgSettings []gomail.MessageSetting
+	if use8BitBody(smtpServer, smtpPort) {
+		msgSettings = append(msgSettings, gomail.SetEncoding(gomail.Unencoded))
+	}
+	msg := gomail.NewMessage(msgSettings...)
+	msg.SetHeader("From", formatAddressHeader(from))
+	// By default the original sender is in To and the recipients are hidden in Bcc; a recipient
+	// who is also the sender only needs to be in To. In to mode the recipients are the To.
+	fields := recipientFields{To: []string{toHeader(original.Envelope.From[0])}, Bcc: recipients}
+	if forwardMode() == forwardModeTo {
+		fields = recipientFields{To: recipients}
+	}
+	fields = fields.dedupe()
+	msg.SetHeader("To", fields.To...)
+	msg.SetHeader("Reply-To", replyToHeader(original, reply))
+	if len(fields.Bcc) > 0 {
+		msg.SetHeader("Bcc", fields.Bcc...)
+	}
+	msg.SetHeader("Subject", subject)
+
+	// In reply style, thread the forward below the original message
+	if inReplyTo, references := threadingHeaders(original); inReplyTo != "" {
+		msg.SetHeader("In-Reply-To", inReplyTo)
+		msg.SetHeader("References", references)
+	}
+
+	for key, value := range debugHeaders(original) {
+		msg.SetHeader(key, value)
+	}
+	for key, value := range priorityHeaders(original) {
+		msg.SetHeader(key, value)
+	}
+
+	// Set body (text/plain is required, HTML is optional and added as alternative)
+	textBody := original.TextBody
+	if viper.GetBool("forward.trim_quotes") {
+		// Keep only the new content, dropping quoted reply history
+		textBody = trimQuotedReplies(textBody)
+	}
+	ref := sourceReference(original)
+	msg.SetBody("text/plain", appendTextFooter(appendSourceReference(textBody, ref)))
+
+	if original.HTMLBody != "" {
+		msg.AddAlternative("text/html", appendHTMLFooter(appendSourceReferenceHTML(wrapHTMLBody(original), ref)))
+	}
+
+	attachFiles(msg, original.Attachments)
+	embedImages(msg, original.InlineImages, original.HTMLBody != "")
+
+	// Attempt to send the message
+	if err := session.send(envelopeSender(from), envelopeRecipients(to, recipients), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// debugHeaders returns headers explaining why a message was forwarded, if `forward.debug_headers`
+// is enabled, and how many hops the original took, if `forward.include_hop_count` is enabled
+func debugHeaders(original MailSummary) map[string]string {
+	headers := make(map[string]string)
+	if viper.GetBool("forward.debug_headers") && original.MatchedBy != "" {
+		headers["X-Mail-Reflector-Matched-From"] = original.MatchedBy
+	}
+	if viper.GetBool("forward.include_hop_count") {
+		headers["X-Mail-Reflector-Hops"] = strconv.Itoa(len(original.Headers.Values("Received")))
+	}
+	return headers
+}
+
+// sendPassthrough re-addresses the original message (see buildPassthroughMessage) and sends it
+// to the recipients and, as in the composed mode, the original sender
+func sendPassthrough(session *smtpSession, original MailSummary, from, subject string, recipients []string) (io.WriterTo, error) {
+	sender := original.Envelope.From[0]
+	to := toHeader(sender)
+	reply := replyToHeader(original, resolveReplyTo(original))
+
+	raw, err := buildPassthroughMessage(original, from, to, reply, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.send(envelopeSender(from), envelopeRecipients(sender.Address(), recipients), rawMessage(raw)); err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Forwarded original MIME structure unchanged", "uid", original.UID, "size", len(raw))
+	return bytes.NewReader(raw), nil
+}
+
+// sendMessage delivers msg over a new SMTP connection with an explicit envelope, so the
+// envelope sender (MAIL FROM) can differ from the From header
+func sendMessage(envelopeFrom string, rcpts []string, msg io.WriterTo) error {
+	return sendMessageWith(newSMTPDialer(), envelopeFrom, rcpts, msg)
+}
+
+// sendMessageWith is sendMessage over a connection from dialer
+func sendMessageWith(dialer *gomail.Dialer, envelopeFrom string, rcpts []string, msg io.WriterTo) error {
+	s, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = s.Close() }()
+
+	return s.Send(envelopeFrom, rcpts, msg)
+}
+
+// envelopeSender returns the SMTP envelope sender (MAIL FROM, which becomes the Return-Path
+// bounces go to): `smtp.envelope_from` if configured, otherwise the address of the From header
+func envelopeSender(from string) string {
+	if envFrom := viper.GetString("smtp.envelope_from"); envFrom != "" {
+		return envFrom
+	}
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+// envelopeRecipients returns the bare, deduplicated RCPT TO addresses: the original sender
+// (who is in To, except in to mode) followed by the configured recipients. In redirect mode
+// only the redirect address receives the forward.
+func envelopeRecipients(sender string, recipients []string) []string {
+	if redirect := redirectAddress(); redirect != "" {
+		return []string{redirect}
+	}
+
+	var rcpts []string
+	if forwardMode() != forwardModeTo {
+		rcpts = append(rcpts, sender)
+	}
+	for _, r := range recipients {
+		if addr, err := mail.ParseAddress(r); err == nil {
+			r = addr.Address
+		}
+		if !slices.Contains(rcpts, r) {
+			rcpts = append(rcpts, r)
+		}
+	}
+	return rcpts
+}
+
+// toHeader returns the visible To header of a forward: the original sender, or the redirect
+// address in redirect mode
+func toHeader(sender *imap.Address) string {
+	if redirect := redirectAddress(); redirect != "" {
+		return redirect
+	}
+	return addressHeader(sender.PersonalName, sender.Address())
+}
+
+// newSMTPDialer configures the SMTP dialer from config
+func newSMTPDialer() *gomail.Dialer {
+	smtpServer := viper.GetString("smtp.server")
+	dialer := gomail.NewDialer(smtpServer, viper.GetInt("smtp.port"),
+		viper.GetString("smtp.username"), viper.GetString("smtp.password"))
+
+	// Enable secure transport if configured
+	dialer.SSL = viper.GetString("smtp.security") == "ssl"
+	dialer.TLSConfig = smtpTLSConfig(smtpServer)
+
+	// Optionally force an AUTH mechanism for servers that misbehave with the negotiated one
+	dialer.Auth = smtpAuth(smtpServer, viper.GetString("smtp.username"), viper.GetString("smtp.password"))
+	return dialer
+}
+
+// resolveReplyTo picks the Reply-To address for a forward. By default replies go to the
+// original sender; with `forward.reply_to: delivered_to` they go to the alias the mail
+// was delivered to (Delivered-To / X-Original-To), falling back to the sender.
+func resolveReplyTo(original MailSummary) string {
+	sender := original.Envelope.From[0].Address()
+
+	if viper.GetString("forward.reply_to") != "delivered_to" {
+		return sender
+	}
+
+	for _, key := range []string{"Delivered-To", "X-Original-To"} {
+		if addr := strings.TrimSpace(original.Headers.Get(key)); addr != "" {
+			return addr
+		}
+	}
+
+	slog.Debug("No delivery address found, using sender as Reply-To", "uid", original.UID)
+	return sender
+}
+
+// Forward styles controlling how recipients' mail clients thread forwarded messages
+const (
+	forwardStyleForward = "forward" // a fresh message (default)
+	forwardStyleReply   = "reply"   // a reply to the original, continuing its thread
+)
+
+// forwardStyle returns the configured `forward.style`
+func forwardStyle() string {
+	if viper.GetString("forward.style") == forwardStyleReply {
+		return forwardStyleReply
+	}
+	return forwardStyleForward
+}
+
+// forwardSubject builds the outgoing subject: the optional `subject.prefix` followed by the
+// original subject, which is marked as a reply ("Re:") in reply style unless it already is one.
+// A `subject.template` takes precedence over the prefix.
+func forwardSubject(original MailSummary) string {
+	subject := original.Envelope.Subject
+	if forwardStyle() == forwardStyleReply && !hasReplyPrefix(subject) {
+		subject = "Re: " + subject
+	}
+
+	if rendered, ok := renderSubjectTemplate(original, subject); ok {
+		return sanitizeHeaderValue(rendered)
+	}
+	if prefix := sanitizeHeaderValue(viper.GetString("subject.prefix")); prefix != "" {
+		subject = fmt.Sprintf("%s %s", prefix, subject)
+	}
+	return sanitizeHeaderValue(subject)
+}
+
+// sanitizeHeaderValue makes a string safe to use as a header value: line breaks and tabs
+// become spaces and other control characters are dropped, so config values or original
+// subjects can't inject additional headers
+func sanitizeHeaderValue(value string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r' || r == '\n' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, value))
+}
+
+// hasReplyPrefix reports whether a subject already starts with "Re:" (case-insensitive)
+func hasReplyPrefix(subject string) bool {
+	return len(subject) >= 3 && strings.EqualFold(subject[:3], "re:")
+}
+
+// threadingHeaders returns the In-Reply-To and References values for reply style,
+// or empty strings for the forward style or when the original has no Message-ID
+func threadingHeaders(original MailSummary) (inReplyTo, references string) {
+	if forwardStyle() != forwardStyleReply || original.Envelope.MessageId == "" {
+		return "", ""
+	}
+
+	inReplyTo = original.Envelope.MessageId
+	references = inReplyTo
+	if prev := strings.TrimSpace(original.Headers.Get("References")); prev != "" {
+		references = prev + " " + inReplyTo
+	}
+	return inReplyTo, references
+}
+
+// addressHeader formats a single address for a header. Display names containing commas,
+// quotes or non-ASCII characters are quoted or RFC 2047 encoded, and an empty name is omitted.
+func addressHeader(name, address string) string {
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+// formatAddressHeader normalizes a configured address (bare or "Name <address>") for a header,
+// leaving it unchanged if it can't be parsed
+func formatAddressHeader(raw string) string {
+	addr, err := mail.ParseAddress(raw)
+	if err != nil {
+		slog.Debug("Could not parse address, using it verbatim", "address", raw, "error", err)
+		return raw
+	}
+	return addressHeader(addr.Name, addr.Address)
+}
+
+// replyToHeader formats the Reply-To header, keeping the sender's display name when
+// replies go to the original sender
+func replyToHeader(original MailSummary, reply string) string {
+	sender := original.Envelope.From[0]
+	if strings.EqualFold(reply, sender.Address()) {
+		return addressHeader(sender.PersonalName, reply)
+	}
+	return formatAddressHeader(reply)
+}
+
+// embedImages re-embeds the inline images of an HTML mail with their original Content-ID, so
+// `cid:` references keep working. Without an HTML body nothing references them, so they are
+// attached instead of being lost.
+func embedImages(msg *gomail.Message, images []InlineImage, hasHTML bool) {
+	for _, img := range images {
+		header := map[string][]string{"Content-Type": {img.ContentType}}
+		if img.ContentID != "" {
+			header["Content-ID"] = []string{"<" + img.ContentID + ">"}
+		}
+
+		settings := []gomail.FileSetting{
+			gomail.SetHeader(header),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(img.Data)
+				return err
+			}),
+		}
+		if hasHTML {
+			msg.Embed(img.Filename, settings...)
+		} else {
+			msg.Attach(img.Filename, settings...)
+		}
+	}
+}
+
+// attachFiles attaches each file from the original mail, preserving its Content-Type and the
+// metadata headers (Content-ID, Content-Description, X-) captured by extractBodies
+func attachFiles(msg *gomail.Message, attachments []Attachment) {
+	for _, att := range attachments {
+		header := map[string][]string{"Content-Type": {att.ContentType}}
+		for key, values := range att.Headers {
+			header[key] = values
+		}
+
+		msg.Attach(att.Filename,
+			gomail.SetHeader(header),
+
+			// Copy the raw data into the attachment
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(att.Data)
+				return err
+			}),
+		)
+	}
+}
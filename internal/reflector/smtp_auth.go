@@ -0,0 +1,64 @@
+package reflector
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// SMTP AUTH mechanisms selectable with `smtp.auth_mechanism`
+const (
+	smtpAuthAuto    = "auto" // let gomail pick from what the server advertises (default)
+	smtpAuthPlain   = "plain"
+	smtpAuthLogin   = "login"
+	smtpAuthCRAMMD5 = "cram-md5"
+)
+
+// smtpAuth returns the smtp.Auth forcing the configured `smtp.auth_mechanism`, or nil to let
+// gomail negotiate the mechanism automatically
+func smtpAuth(host, username, password string) smtp.Auth {
+	switch strings.ToLower(viper.GetString("smtp.auth_mechanism")) {
+	case smtpAuthPlain:
+		return smtp.PlainAuth("", username, password, host)
+	case smtpAuthLogin:
+		return &loginAuth{username: username, password: password, host: host}
+	case smtpAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password)
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the non-standard but widespread LOGIN mechanism, which net/smtp lacks
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like PLAIN, LOGIN sends the password in the clear, so only allow it over TLS
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection, refusing to send credentials with AUTH LOGIN")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected AUTH LOGIN challenge %q", fromServer)
+	}
+}
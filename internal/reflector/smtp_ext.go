@@ -0,0 +1,124 @@
+package reflector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// smtpExtensions describes the relevant ESMTP extensions advertised by the SMTP server
+type smtpExtensions struct {
+	EightBitMIME bool // 8BITMIME: 8-bit message bodies are accepted
+	SMTPUTF8     bool // SMTPUTF8: UTF-8 is accepted in headers and addresses
+}
+
+// smtpExtCache remembers probed extensions per server so the probe runs once per process
+var (
+	smtpExtCache = make(map[string]smtpExtensions)
+	smtpExtMu    sync.Mutex
+)
+
+// smtpTLSConfig returns the TLS settings used for connections to the SMTP server. The
+// certificate is verified against server unless `smtp.insecure_skip_verify` is enabled.
+func smtpTLSConfig(server string) *tls.Config {
+	config := &tls.Config{ServerName: server}
+	if viper.GetBool("smtp.insecure_skip_verify") {
+		slog.Warn("SMTP certificate verification is DISABLED (smtp.insecure_skip_verify), connections can be intercepted", "server", server)
+		config.InsecureSkipVerify = true
+	}
+	return withCertExpiryCheck(config, "smtp")
+}
+
+// getSMTPExtensions returns the extensions advertised by the configured SMTP server, probing it on first use
+func getSMTPExtensions(server string, port int) (smtpExtensions, error) {
+	key := net.JoinHostPort(server, strconv.Itoa(port))
+
+	smtpExtMu.Lock()
+	defer smtpExtMu.Unlock()
+
+	if ext, ok := smtpExtCache[key]; ok {
+		return ext, nil
+	}
+
+	ext, err := probeSMTPExtensions(server, port)
+	if err != nil {
+		return smtpExtensions{}, err
+	}
+
+	slog.Debug("Probed SMTP server extensions", "server", key, "8bitmime", ext.EightBitMIME, "smtputf8", ext.SMTPUTF8)
+	smtpExtCache[key] = ext
+	return ext, nil
+}
+
+// probeSMTPExtensions connects to the SMTP server and reads its EHLO response
+// (after STARTTLS when not using implicit TLS, as extensions may differ)
+func probeSMTPExtensions(server string, port int) (smtpExtensions, error) {
+	address := net.JoinHostPort(server, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	tlsConfig := smtpTLSConfig(server)
+
+	var conn net.Conn
+	var err error
+	if viper.GetString("smtp.security") == "ssl" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return smtpExtensions{}, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, server)
+	if err != nil {
+		_ = conn.Close()
+		return smtpExtensions{}, fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return smtpExtensions{}, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	var ext smtpExtensions
+	ext.EightBitMIME, _ = c.Extension("8BITMIME")
+	ext.SMTPUTF8, _ = c.Extension("SMTPUTF8")
+
+	_ = c.Quit()
+	return ext, nil
+}
+
+// use8BitBody decides whether forwarded bodies may be sent unencoded as 8-bit.
+// This is only done when `smtp.allow_8bit` is enabled and the server advertises 8BITMIME;
+// otherwise bodies are quoted-printable encoded and non-ASCII headers RFC 2047 encoded.
+func use8BitBody(server string, port int) bool {
+	if !viper.GetBool("smtp.allow_8bit") {
+		return false
+	}
+
+	ext, err := getSMTPExtensions(server, port)
+	if err != nil {
+		slog.Warn("Could not probe SMTP extensions, falling back to 7-bit encoding", "error", err)
+		return false
+	}
+
+	if !ext.EightBitMIME {
+		slog.Info("SMTP server doesn't advertise 8BITMIME, encoding bodies as quoted-printable")
+		return false
+	}
+
+	if !ext.SMTPUTF8 {
+		slog.Debug("SMTP server doesn't advertise SMTPUTF8, non-ASCII headers stay RFC 2047 encoded")
+	}
+
+	slog.Info("Sending 8-bit body", "smtputf8", ext.SMTPUTF8)
+	return true
+}
@@ -0,0 +1,77 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	gomail "gopkg.in/gomail.v2"
+)
+
+// smtpSession keeps one SMTP connection open across the forwards of a processing run, instead
+// of connecting and authenticating for every message. It connects on the first send and
+// reconnects after an error. A nil session sends every message over its own connection.
+type smtpSession struct {
+	sender gomail.SendCloser
+}
+
+// newSMTPSession returns a session for a processing run; it must be closed when the run is done
+func newSMTPSession() *smtpSession {
+	return &smtpSession{}
+}
+
+// rawMessage is a complete message that writes itself from the start on every WriteTo, unlike
+// a bytes.Reader, which a failed attempt may have partly consumed
+type rawMessage []byte
+
+// WriteTo writes the whole message to w
+func (m rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m)
+	return int64(n), err
+}
+
+// send delivers msg like sendMessage, reusing the session's connection. A failure on a
+// reused connection (e.g. one the server has timed out) is retried once on a fresh one, so
+// msg must write the whole message on every WriteTo (see rawMessage).
+func (s *smtpSession) send(envelopeFrom string, rcpts []string, msg io.WriterTo) error {
+	if s == nil {
+		return sendMessage(envelopeFrom, rcpts, msg)
+	}
+
+	reused := s.sender != nil
+	err := s.trySend(envelopeFrom, rcpts, msg)
+	if err != nil && reused {
+		slog.Debug("Sending over the open SMTP connection failed, reconnecting", "error", err)
+		err = s.trySend(envelopeFrom, rcpts, msg)
+	}
+	return err
+}
+
+// trySend sends msg over the open connection, connecting first if there is none. The
+// connection is dropped on failure, as its state is unknown afterwards.
+func (s *smtpSession) trySend(envelopeFrom string, rcpts []string, msg io.WriterTo) error {
+	if s.sender == nil {
+		sender, err := newSMTPDialer().Dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to SMTP server: %w", err)
+		}
+		s.sender = sender
+	}
+
+	if err := s.sender.Send(envelopeFrom, rcpts, msg); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// Close closes the session's connection, if open. A nil session is a no-op.
+func (s *smtpSession) Close() {
+	if s == nil || s.sender == nil {
+		return
+	}
+	if err := s.sender.Close(); err != nil {
+		slog.Debug("Failed to close SMTP connection", "error", err)
+	}
+	s.sender = nil
+}
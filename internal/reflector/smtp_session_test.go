@@ -0,0 +1,163 @@
+package reflector
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+	gomail "gopkg.in/gomail.v2"
+)
+
+// fakeSMTPServer accepts mail without authentication and counts connections and messages.
+// With closeAfterMessage set, it hangs up after every message, like a server timing out
+// idle connections.
+type fakeSMTPServer struct {
+	mu                sync.Mutex
+	connections       int
+	messages          int
+	closeAfterMessage bool
+}
+
+// start listens on a random local port and configures smtp.server/smtp.port to use it
+func (s *fakeSMTPServer) start(t *testing.T) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	viper.Set("smtp.server", host)
+	viper.Set("smtp.port", portNum)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if data == ".\r\n" {
+					break
+				}
+			}
+			s.mu.Lock()
+			s.messages++
+			s.mu.Unlock()
+			reply("250 queued")
+			if s.closeAfterMessage {
+				return
+			}
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) counts() (connections, messages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.messages
+}
+
+func TestSMTPSession(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	newMessage := func() *gomail.Message {
+		msg := gomail.NewMessage()
+		msg.SetHeader("From", "list@example.org")
+		msg.SetHeader("To", "a@example.org")
+		msg.SetBody("text/plain", "Hello")
+		return msg
+	}
+
+	srv := &fakeSMTPServer{}
+	srv.start(t)
+
+	session := newSMTPSession()
+	for range 3 {
+		if err := session.send("list@example.org", []string{"a@example.org"}, newMessage()); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	session.Close()
+	if connections, messages := srv.counts(); connections != 1 || messages != 3 {
+		t.Errorf("a session should send 3 messages over 1 connection, got %d messages over %d", messages, connections)
+	}
+
+	// A connection closed by the server is replaced transparently
+	dropping := &fakeSMTPServer{closeAfterMessage: true}
+	dropping.start(t)
+
+	session = newSMTPSession()
+	defer session.Close()
+	for range 2 {
+		if err := session.send("list@example.org", []string{"a@example.org"}, newMessage()); err != nil {
+			t.Fatalf("send after the server hung up failed: %v", err)
+		}
+	}
+	if connections, messages := dropping.counts(); connections != 2 || messages != 2 {
+		t.Errorf("expected 2 messages over 2 connections, got %d messages over %d", messages, connections)
+	}
+
+	// A raw message is written in full on every attempt
+	raw := rawMessage("Subject: Hi\r\n\r\nHello\r\n")
+	for range 2 {
+		var buf strings.Builder
+		if _, err := raw.WriteTo(&buf); err != nil || buf.String() != string(raw) {
+			t.Errorf("expected the whole message on every write, got %q (err=%v)", buf.String(), err)
+		}
+	}
+	if err := session.send("list@example.org", []string{"a@example.org"}, raw); err != nil {
+		t.Fatalf("sending a raw message failed: %v", err)
+	}
+
+	// Without a session every message gets its own connection
+	var none *smtpSession
+	if err := none.send("list@example.org", []string{"a@example.org"}, newMessage()); err != nil {
+		t.Fatalf("send without session failed: %v", err)
+	}
+	none.Close()
+	if connections, _ := dropping.counts(); connections != 4 {
+		t.Errorf("a nil session should connect per message, got %d connections", connections)
+	}
+}
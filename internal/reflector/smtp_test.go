@@ -0,0 +1,296 @@
+package reflector
+
+import (
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/spf13/viper"
+)
+
+func TestResolveReplyTo(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	envelope := &imap.Envelope{From: []*imap.Address{{MailboxName: "jane", HostName: "example.com"}}}
+
+	var headers message.Header
+	headers.Set("Delivered-To", "board@example.org")
+	withDeliveredTo := MailSummary{Envelope: envelope, Headers: headers}
+	withoutHeaders := MailSummary{Envelope: envelope}
+
+	if got := resolveReplyTo(withDeliveredTo); got != "jane@example.com" {
+		t.Errorf("default mode should reply to sender, got %q", got)
+	}
+
+	viper.Set("forward.reply_to", "delivered_to")
+
+	if got := resolveReplyTo(withDeliveredTo); got != "board@example.org" {
+		t.Errorf("delivered_to mode should reply to the alias, got %q", got)
+	}
+
+	if got := resolveReplyTo(withoutHeaders); got != "jane@example.com" {
+		t.Errorf("delivered_to mode should fall back to sender, got %q", got)
+	}
+}
+
+func TestForwardStyle(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	var headers message.Header
+	headers.Set("References", "<root@example.com>")
+	original := MailSummary{
+		Envelope: &imap.Envelope{Subject: "Einladung", MessageId: "<orig@example.com>"},
+		Headers:  headers,
+	}
+	viper.Set("subject.prefix", "[Vorstand]")
+
+	// Default forward style: fresh message without threading headers
+	if got := forwardSubject(original); got != "[Vorstand] Einladung" {
+		t.Errorf("forward style subject = %q", got)
+	}
+	if inReplyTo, references := threadingHeaders(original); inReplyTo != "" || references != "" {
+		t.Errorf("forward style should not set threading headers, got %q / %q", inReplyTo, references)
+	}
+
+	viper.Set("forward.style", "reply")
+
+	if got := forwardSubject(original); got != "[Vorstand] Re: Einladung" {
+		t.Errorf("reply style subject = %q", got)
+	}
+
+	inReplyTo, references := threadingHeaders(original)
+	if inReplyTo != "<orig@example.com>" {
+		t.Errorf("In-Reply-To = %q", inReplyTo)
+	}
+	if references != "<root@example.com> <orig@example.com>" {
+		t.Errorf("References = %q", references)
+	}
+
+	// An existing reply prefix isn't doubled
+	original.Envelope.Subject = "RE: Einladung"
+	if got := forwardSubject(original); got != "[Vorstand] RE: Einladung" {
+		t.Errorf("reply style subject with existing prefix = %q", got)
+	}
+}
+
+func TestAddressHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		display string
+		address string
+		want    string
+	}{
+		{"no name", "", "jane@example.com", "<jane@example.com>"},
+		{"plain name", "Jane Doe", "jane@example.com", `"Jane Doe" <jane@example.com>`},
+		{"comma", "Doe, Jane", "jane@example.com", `"Doe, Jane" <jane@example.com>`},
+		{"quotes", `Jane "JD" Doe`, "jane@example.com", `"Jane \"JD\" Doe" <jane@example.com>`},
+		{"umlauts", "Jürgen Müller", "juergen@example.com", "=?utf-8?q?J=C3=BCrgen_M=C3=BCller?= <juergen@example.com>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := addressHeader(tt.display, tt.address)
+			if got != tt.want {
+				t.Errorf("addressHeader(%q, %q) = %q, want %q", tt.display, tt.address, got, tt.want)
+			}
+
+			// The header must round-trip to the same name and address
+			parsed, err := mail.ParseAddress(got)
+			if err != nil {
+				t.Fatalf("header %q doesn't parse: %v", got, err)
+			}
+			if parsed.Name != tt.display || parsed.Address != tt.address {
+				t.Errorf("round trip of %q = %q <%s>", got, parsed.Name, parsed.Address)
+			}
+		})
+	}
+
+	// Configured addresses are normalized; unparsable ones are kept verbatim
+	if got := formatAddressHeader(`"Vorstand, Verein" <vorstand@example.org>`); got != `"Vorstand, Verein" <vorstand@example.org>` {
+		t.Errorf("formatAddressHeader with quoted name = %q", got)
+	}
+	if got := formatAddressHeader("Jürgen <juergen@example.com>"); got != "=?utf-8?q?J=C3=BCrgen?= <juergen@example.com>" {
+		t.Errorf("formatAddressHeader with umlaut = %q", got)
+	}
+	if got := formatAddressHeader("not an address"); got != "not an address" {
+		t.Errorf("formatAddressHeader should keep unparsable input, got %q", got)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if got := envelopeSender(`"Board" <board@example.org>`); got != "board@example.org" {
+		t.Errorf("envelope sender should default to the From address, got %q", got)
+	}
+
+	viper.Set("smtp.envelope_from", "bounces@example.org")
+	if got := envelopeSender(`"Board" <board@example.org>`); got != "bounces@example.org" {
+		t.Errorf("envelope sender should use smtp.envelope_from, got %q", got)
+	}
+
+	got := envelopeRecipients("jane@example.com", []string{"a@example.com", "B <b@example.com>", "jane@example.com"})
+	want := []string{"jane@example.com", "a@example.com", "b@example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("envelopeRecipients = %v, want %v", got, want)
+	}
+
+	// In to mode the original sender isn't addressed
+	viper.Set("forward.mode", "to")
+	got = envelopeRecipients("jane@example.com", []string{"a@example.com", "a@example.com"})
+	if !slices.Equal(got, []string{"a@example.com"}) {
+		t.Errorf("envelopeRecipients in to mode = %v", got)
+	}
+}
+
+func TestRedirectMode(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	sender := &imap.Address{PersonalName: "Jane", MailboxName: "jane", HostName: "example.com"}
+	if got := toHeader(sender); !strings.Contains(got, "jane@example.com") {
+		t.Errorf("To should be the original sender, got %q", got)
+	}
+
+	viper.Set("forward.redirect_to", "tester@example.org")
+	if got := toHeader(sender); got != "tester@example.org" {
+		t.Errorf("To should be the redirect address, got %q", got)
+	}
+	got := envelopeRecipients("jane@example.com", []string{"a@example.com", "b@example.com"})
+	if !slices.Equal(got, []string{"tester@example.org"}) {
+		t.Errorf("only the redirect address should receive the forward, got %v", got)
+	}
+}
+
+func TestSMTPAuthMechanism(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	if smtpAuth("smtp.example.org", "user", "secret") != nil {
+		t.Error("auto should leave the mechanism to gomail")
+	}
+
+	viper.Set("smtp.auth_mechanism", "login")
+	auth := smtpAuth("smtp.example.org", "user", "secret")
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.org"}); err == nil {
+		t.Error("LOGIN should be refused without TLS")
+	}
+	mech, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.org", TLS: true})
+	if err != nil || mech != "LOGIN" {
+		t.Fatalf("Start() = %q, %v", mech, err)
+	}
+	for challenge, want := range map[string]string{"Username:": "user", "Password:": "secret"} {
+		if got, err := auth.Next([]byte(challenge), true); err != nil || string(got) != want {
+			t.Errorf("Next(%q) = %q, %v; want %q", challenge, got, err, want)
+		}
+	}
+	if _, err := auth.Next([]byte("Token:"), true); err == nil {
+		t.Error("unknown challenges should fail")
+	}
+}
+
+func TestSMTPTLSConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, security := range []string{"ssl", "starttls"} {
+		viper.Set("smtp.security", security)
+		config := smtpTLSConfig("smtp.example.org")
+		if config.InsecureSkipVerify || config.ServerName != "smtp.example.org" {
+			t.Errorf("%s: certificate should be verified against the server name, got %+v", security, config)
+		}
+	}
+
+	viper.Set("smtp.insecure_skip_verify", true)
+	if !smtpTLSConfig("smtp.example.org").InsecureSkipVerify {
+		t.Error("verification should be skipped when explicitly enabled")
+	}
+}
+
+func TestSubjectSanitizing(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	original := MailSummary{Envelope: &imap.Envelope{Subject: "Einladung\r\nBcc: victim@example.com"}}
+	viper.Set("subject.prefix", "[Vorstand]\r\nX-Injected: yes\x00")
+
+	got := forwardSubject(original)
+	if strings.ContainsAny(got, "\r\n\x00") {
+		t.Fatalf("subject still contains control characters: %q", got)
+	}
+	if want := "[Vorstand]  X-Injected: yes Einladung  Bcc: victim@example.com"; got != want {
+		t.Errorf("forwardSubject = %q, want %q", got, want)
+	}
+
+	if errs := ValidateConfig(); !slices.ContainsFunc(errs, func(err error) bool {
+		return strings.Contains(err.Error(), "subject.prefix")
+	}) {
+		t.Errorf("expected a validation error for subject.prefix, got %v", errs)
+	}
+}
+
+func TestSubjectTemplate(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	original := MailSummary{Envelope: &imap.Envelope{
+		Subject: "Einladung",
+		Date:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local),
+		From:    []*imap.Address{{MailboxName: "vorstand", HostName: "example.org"}},
+	}}
+	viper.Set("subject.prefix", "[Vorstand]")
+	viper.Set("subject.template", "[Newsletter] {{.Subject}} (von {{.From}}, {{.Date}})")
+
+	if got, want := forwardSubject(original), "[Newsletter] Einladung (von vorstand@example.org, 01.03.2024)"; got != want {
+		t.Errorf("forwardSubject = %q, want %q", got, want)
+	}
+
+	// Invalid templates are reported at startup and fall back to the prefix
+	viper.Set("subject.template", "{{.Sender}}")
+	if got := forwardSubject(original); got != "[Vorstand] Einladung" {
+		t.Errorf("expected the prefixed subject as fallback, got %q", got)
+	}
+	if errs := ValidateConfig(); !slices.ContainsFunc(errs, func(err error) bool {
+		return strings.Contains(err.Error(), "subject.template")
+	}) {
+		t.Errorf("expected a validation error for subject.template, got %v", errs)
+	}
+}
+
+func TestHopCount(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	raw := "Received: from mx.example.org by imap.example.org; Mon, 2 Jun 2025 10:00:02 +0000\r\n" +
+		"Received: from relay.example.net by mx.example.org; Mon, 2 Jun 2025 10:00:01 +0000\r\n" +
+		"Received: from laptop by relay.example.net; Mon, 2 Jun 2025 10:00:00 +0000\r\n" +
+		"From: jane@example.com\r\n" +
+		"Subject: Hops\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+	entity, err := message.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := MailSummary{Headers: entity.Header, Raw: []byte(raw)}
+
+	if got := debugHeaders(original); got["X-Mail-Reflector-Hops"] != "" {
+		t.Errorf("hop count should be off by default, got %v", got)
+	}
+
+	viper.Set("forward.include_hop_count", true)
+	if got := debugHeaders(original)["X-Mail-Reflector-Hops"]; got != "3" {
+		t.Errorf("X-Mail-Reflector-Hops = %q, want 3", got)
+	}
+
+	out, err := buildPassthroughMessage(original, "list@example.org", "jane@example.com", "jane@example.com", "Hops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "X-Mail-Reflector-Hops: 3\r\n") {
+		t.Errorf("passthrough forward should carry the hop count, got:\n%s", out)
+	}
+}
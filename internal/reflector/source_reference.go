@@ -0,0 +1,64 @@
+package reflector
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// sourceReference returns the line identifying the original message appended with
+// `forward.include_source_reference`, or "" when the option is disabled
+func sourceReference(original MailSummary) string {
+	if !viper.GetBool("forward.include_source_reference") {
+		return ""
+	}
+
+	from := "unknown sender"
+	date := original.InternalDate
+	if original.Envelope != nil {
+		if addr := getFromAddress(original.Envelope); addr != "" {
+			from = addr
+		}
+		if !original.Envelope.Date.IsZero() {
+			date = original.Envelope.Date
+		}
+	}
+
+	ref := "Original message from " + from
+	if !date.IsZero() {
+		ref += ", sent " + date.Format(time.RFC1123Z)
+	}
+	if original.UID != 0 {
+		ref += fmt.Sprintf(", %s UID %d", sourceMailbox, original.UID)
+	}
+	return ref
+}
+
+// appendSourceReference appends ref to a text/plain body below a signature separator
+func appendSourceReference(text, ref string) string {
+	if ref == "" {
+		return text
+	}
+	return strings.TrimRight(text, "\r\n") + "\n\n-- \n" + ref + "\n"
+}
+
+// appendSourceReferenceHTML appends ref to an HTML body, inside <body> when there is one
+func appendSourceReferenceHTML(body, ref string) string {
+	if ref == "" || body == "" {
+		return body
+	}
+
+	return insertBeforeBodyEnd(body, `<p style="color:#888;font-size:small">`+html.EscapeString(ref)+"</p>")
+}
+
+// insertBeforeBodyEnd adds fragment at the end of an HTML document's <body>, or at the very
+// end if there is no closing body tag
+func insertBeforeBodyEnd(body, fragment string) string {
+	if idx := strings.LastIndex(strings.ToLower(body), "</body>"); idx >= 0 {
+		return body[:idx] + fragment + body[idx:]
+	}
+	return body + fragment
+}
@@ -0,0 +1,40 @@
+package reflector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/spf13/viper"
+)
+
+func TestSourceReference(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	original := MailSummary{
+		UID: 42,
+		Envelope: &imap.Envelope{
+			Date: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+			From: []*imap.Address{{MailboxName: "alice", HostName: "example.org"}},
+		},
+	}
+
+	if ref := sourceReference(original); ref != "" {
+		t.Errorf("expected no reference when disabled, got %q", ref)
+	}
+
+	viper.Set("forward.include_source_reference", true)
+	ref := sourceReference(original)
+	want := "Original message from alice@example.org, sent Fri, 01 Mar 2024 09:30:00 +0000, INBOX UID 42"
+	if ref != want {
+		t.Errorf("unexpected reference:\n got: %s\nwant: %s", ref, want)
+	}
+
+	if got := appendSourceReference("Hello\n\n", ref); got != "Hello\n\n-- \n"+ref+"\n" {
+		t.Errorf("unexpected text body: %q", got)
+	}
+	got := appendSourceReferenceHTML("<html><body><p>Hi</p></BODY></html>", "a <b>")
+	if got != `<html><body><p>Hi</p><p style="color:#888;font-size:small">a &lt;b&gt;</p></BODY></html>` {
+		t.Errorf("unexpected HTML body: %s", got)
+	}
+}
@@ -0,0 +1,234 @@
+package reflector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Forward states recorded per Message-ID in the state store
+const (
+	forwardStatusForwarding = "forwarding" // written before sending
+	forwardStatusForwarded  = "forwarded"  // written after a successful send
+	forwardStatusSkipped    = "skipped"    // marked as seen by the backlog policy without forwarding
+	forwardStatusGivenUp    = "given_up"   // dead-lettered after `forward.max_attempts` failed forwards
+)
+
+// forwardRecord tracks the progress of forwarding a single message
+type forwardRecord struct {
+	Status    string    `json:"status"`
+	Subject   string    `json:"subject,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// stateStore is a small JSON file persisting processing state across runs and crashes
+type stateStore struct {
+	mu       sync.Mutex
+	path     string
+	Forwards map[string]*forwardRecord `json:"forwards"`           // keyed by Message-ID
+	Failures map[string]int            `json:"failures,omitempty"` // failed forward attempts by Message-ID
+
+	// ContentHashes records when content (see contentHash) was last forwarded, for `dedup.by_content_hash`
+	ContentHashes map[string]time.Time `json:"content_hashes,omitempty"`
+
+	// HighWaterMark is the INBOX UID up to which `check` has processed all mail
+	HighWaterMark *highWaterMark `json:"high_water_mark,omitempty"`
+}
+
+// highWaterMark is only meaningful within the UIDVALIDITY it was recorded for
+type highWaterMark struct {
+	UID         uint32    `json:"uid"`
+	UIDValidity uint32    `json:"uid_validity"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var (
+	stateOnce   sync.Once
+	sharedState *stateStore
+)
+
+// getStateStore returns the process-wide state store, or nil if `state.file` isn't configured
+func getStateStore() *stateStore {
+	stateOnce.Do(func() {
+		path := viper.GetString("state.file")
+		if path == "" {
+			return
+		}
+
+		store, err := loadStateStore(path)
+		if err != nil {
+			slog.Error("Could not load state file, continuing without it", "path", path, "error", err)
+			return
+		}
+		sharedState = store
+	})
+	return sharedState
+}
+
+// loadStateStore reads the state file at path, starting empty if it doesn't exist yet
+func loadStateStore(path string) (*stateStore, error) {
+	store := &stateStore{
+		path:          path,
+		Forwards:      make(map[string]*forwardRecord),
+		Failures:      make(map[string]int),
+		ContentHashes: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	if store.Forwards == nil {
+		store.Forwards = make(map[string]*forwardRecord)
+	}
+	if store.Failures == nil {
+		store.Failures = make(map[string]int)
+	}
+	if store.ContentHashes == nil {
+		store.ContentHashes = make(map[string]time.Time)
+	}
+	store.pruneLocked()
+
+	// Forwards interrupted by a crash can't be confirmed; they are retried when the message is seen again
+	for id, rec := range store.Forwards {
+		if rec.Status == forwardStatusForwarding {
+			slog.Warn("Found interrupted forward from a previous run, it will be retried",
+				"message_id", id, "subject", rec.Subject, "since", rec.UpdatedAt)
+		}
+	}
+
+	return store, nil
+}
+
+// forwardStatus returns the recorded forward status of a message, or "" if unknown
+func (s *stateStore) forwardStatus(messageID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.Forwards[messageID]; ok {
+		return rec.Status
+	}
+	return ""
+}
+
+// setForwardStatus records the forward status of a message and persists the store
+func (s *stateStore) setForwardStatus(messageID, subject, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Forwards[messageID] = &forwardRecord{Status: status, Subject: subject, UpdatedAt: time.Now()}
+	if status != forwardStatusForwarding {
+		// A final status ends the count of failed attempts
+		delete(s.Failures, messageID)
+	}
+	s.pruneLocked()
+	return s.saveLocked()
+}
+
+// pruneLocked drops forward records last updated more than `forward.dedup_ttl` ago, so the
+// state file doesn't grow forever; the caller must hold s.mu. Without a TTL records are kept.
+func (s *stateStore) pruneLocked() {
+	ttl := viper.GetDuration("forward.dedup_ttl")
+	if ttl <= 0 {
+		return
+	}
+
+	pruned := 0
+	for id, rec := range s.Forwards {
+		if time.Since(rec.UpdatedAt) > ttl {
+			delete(s.Forwards, id)
+			delete(s.Failures, id)
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		slog.Debug("Pruned expired forward records from state file", "count", pruned, "ttl", ttl)
+	}
+}
+
+// recordFailedAttempt counts a failed forward of a message across runs and returns the new count
+func (s *stateStore) recordFailedAttempt(messageID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failures[messageID]++
+	return s.Failures[messageID], s.saveLocked()
+}
+
+// contentSeen reports whether content with hash was forwarded within window
+func (s *stateStore) contentSeen(hash string, window time.Duration) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.ContentHashes[hash]
+	return at, ok && time.Since(at) < window
+}
+
+// recordContentHash records that content with hash was forwarded now, drops hashes older than
+// window, and persists the store
+func (s *stateStore) recordContentHash(hash string, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, at := range s.ContentHashes {
+		if time.Since(at) >= window {
+			delete(s.ContentHashes, h)
+		}
+	}
+	s.ContentHashes[hash] = time.Now()
+	return s.saveLocked()
+}
+
+// saveLocked atomically writes the store to disk; the caller must hold s.mu
+func (s *stateStore) saveLocked() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".mail-reflector-state-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// highWaterMark returns the recorded high-water mark for a UIDVALIDITY, if there is one
+func (s *stateStore) highWaterMark(uidValidity uint32) (uint32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.HighWaterMark == nil || s.HighWaterMark.UIDValidity != uidValidity {
+		return 0, false
+	}
+	return s.HighWaterMark.UID, true
+}
+
+// setHighWaterMark records the UID up to which all mail has been processed and persists the store
+func (s *stateStore) setHighWaterMark(uid, uidValidity uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.HighWaterMark = &highWaterMark{UID: uid, UIDValidity: uidValidity, UpdatedAt: time.Now()}
+	return s.saveLocked()
+}
@@ -0,0 +1,105 @@
+package reflector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestStateStore_PersistsForwardStatus(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	store, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to load empty state: %v", err)
+	}
+
+	if err := store.setForwardStatus("<a@example.com>", "Hello", forwardStatusForwarding); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	if err := store.setForwardStatus("<b@example.com>", "World", forwardStatusForwarded); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload state: %v", err)
+	}
+
+	if got := reloaded.forwardStatus("<a@example.com>"); got != forwardStatusForwarding {
+		t.Errorf("unexpected status for a: %q", got)
+	}
+	if got := reloaded.forwardStatus("<b@example.com>"); got != forwardStatusForwarded {
+		t.Errorf("unexpected status for b: %q", got)
+	}
+	if got := reloaded.forwardStatus("<unknown@example.com>"); got != "" {
+		t.Errorf("unexpected status for unknown message: %q", got)
+	}
+}
+
+func TestStateStore_CountsFailedAttempts(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to load empty state: %v", err)
+	}
+
+	for want := 1; want <= 2; want++ {
+		got, err := store.recordFailedAttempt("<a@example.com>")
+		if err != nil || got != want {
+			t.Fatalf("recordFailedAttempt = %d, %v; want %d", got, err, want)
+		}
+	}
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload state: %v", err)
+	}
+	if got := reloaded.Failures["<a@example.com>"]; got != 2 {
+		t.Errorf("expected 2 failed attempts after reload, got %d", got)
+	}
+
+	if err := reloaded.setForwardStatus("<a@example.com>", "Hello", forwardStatusForwarded); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	if _, ok := reloaded.Failures["<a@example.com>"]; ok {
+		t.Error("a successful forward should reset the failure count")
+	}
+}
+
+func TestStateStore_PrunesExpiredForwards(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("failed to load empty state: %v", err)
+	}
+	store.Forwards["<old@example.com>"] = &forwardRecord{Status: forwardStatusForwarded, UpdatedAt: time.Now().Add(-48 * time.Hour)}
+	store.Failures["<old@example.com>"] = 2
+
+	// Without a TTL records are kept
+	if err := store.setForwardStatus("<new@example.com>", "New", forwardStatusForwarded); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	if store.forwardStatus("<old@example.com>") == "" {
+		t.Error("records should be kept without forward.dedup_ttl")
+	}
+
+	viper.Set("forward.dedup_ttl", "24h")
+	if err := store.setForwardStatus("<newer@example.com>", "Newer", forwardStatusForwarded); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	if store.forwardStatus("<old@example.com>") != "" || store.Failures["<old@example.com>"] != 0 {
+		t.Error("records older than forward.dedup_ttl should be pruned")
+	}
+	if store.forwardStatus("<new@example.com>") != forwardStatusForwarded {
+		t.Error("recent records should be kept")
+	}
+}
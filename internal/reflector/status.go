@@ -0,0 +1,105 @@
+package reflector
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meko-christian/mail-reflector/internal/metrics"
+	"github.com/spf13/viper"
+)
+
+// Status reports the health of the serve loop, e.g. for the web server's /healthz route
+type Status struct {
+	// IMAPConnected reports whether the last IMAP connection attempt succeeded
+	IMAPConnected bool `json:"imap_connected"`
+	// LastConnectAttempt is the time of the last IMAP connection attempt
+	LastConnectAttempt time.Time `json:"last_connect_attempt"`
+	// LastConnectError is the error of the last connection attempt, if it failed
+	LastConnectError string `json:"last_connect_error,omitempty"`
+	// ConnectFailures counts the consecutive failed connection attempts
+	ConnectFailures int `json:"connect_failures"`
+	// ConnectAlert is set once ConnectFailures reached `serve.alert_after_failures`
+	ConnectAlert bool `json:"connect_alert"`
+	// LastCheck is when the mailbox was last checked successfully
+	LastCheck time.Time `json:"last_check"`
+	// Enabled is false while forwarding is paused with `enabled: false`
+	Enabled bool `json:"enabled"`
+}
+
+// serveStatus is the status published by Serve
+var (
+	serveStatus   Status
+	serveStatusMu sync.RWMutex
+)
+
+// CurrentStatus returns a snapshot of the serve loop's status
+func CurrentStatus() Status {
+	serveStatusMu.RLock()
+	status := serveStatus
+	serveStatusMu.RUnlock()
+
+	status.Enabled = forwardingEnabled()
+	return status
+}
+
+// recordConnectAttempt publishes the outcome of an IMAP connection attempt. After
+// `serve.alert_after_failures` consecutive failures it notifies the operators once, and
+// again when a connection succeeds after that.
+func recordConnectAttempt(err error) {
+	serveStatusMu.Lock()
+	defer serveStatusMu.Unlock()
+	serveStatus.LastConnectAttempt = time.Now()
+	serveStatus.IMAPConnected = err == nil
+	serveStatus.LastConnectError = ""
+	if err != nil {
+		serveStatus.LastConnectError = err.Error()
+	}
+	metrics.IMAPConnected.Set(boolGauge(err == nil))
+
+	if err == nil {
+		if serveStatus.ConnectAlert {
+			slog.Info("IMAP connection restored", "failed_attempts", serveStatus.ConnectFailures)
+			notifyAsync("imap_connection_restored", "The IMAP connection is working again",
+				map[string]string{"failed_attempts": strconv.Itoa(serveStatus.ConnectFailures)})
+		}
+		serveStatus.ConnectFailures = 0
+		serveStatus.ConnectAlert = false
+		metrics.IMAPConnectAlert.Set(0)
+		return
+	}
+
+	serveStatus.ConnectFailures++
+	threshold := viper.GetInt("serve.alert_after_failures")
+	if threshold > 0 && serveStatus.ConnectFailures >= threshold && !serveStatus.ConnectAlert {
+		serveStatus.ConnectAlert = true
+		metrics.IMAPConnectAlert.Set(1)
+		slog.Error("IMAP connection keeps failing", "failed_attempts", serveStatus.ConnectFailures, "error", err)
+		notifyAsync("imap_connection_failing", "Connecting to the IMAP server failed repeatedly",
+			map[string]string{"failed_attempts": strconv.Itoa(serveStatus.ConnectFailures), "error": err.Error()})
+	}
+}
+
+// recordDisconnect publishes that the IMAP connection was closed
+func recordDisconnect() {
+	serveStatusMu.Lock()
+	defer serveStatusMu.Unlock()
+	serveStatus.IMAPConnected = false
+	metrics.IMAPConnected.Set(0)
+}
+
+// recordCheck publishes a successful mailbox check that started at ts
+func recordCheck(ts time.Time) {
+	serveStatusMu.Lock()
+	defer serveStatusMu.Unlock()
+	serveStatus.LastCheck = ts
+}
+
+// boolGauge converts a flag to a gauge value
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+package reflector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConnectFailureAlert(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(waitForNotifications)
+	t.Cleanup(func() { recordConnectAttempt(nil) })
+
+	viper.Set("serve.alert_after_failures", 3)
+	recordConnectAttempt(nil)
+
+	failure := errors.New("authentication failed")
+	for i := 1; i <= 2; i++ {
+		recordConnectAttempt(failure)
+		if s := CurrentStatus(); s.ConnectFailures != i || s.ConnectAlert {
+			t.Fatalf("expected no alert after %d failures, got %+v", i, s)
+		}
+	}
+
+	recordConnectAttempt(failure)
+	if s := CurrentStatus(); !s.ConnectAlert {
+		t.Errorf("expected an alert after 3 failures, got %+v", s)
+	}
+
+	recordConnectAttempt(nil)
+	if s := CurrentStatus(); s.ConnectFailures != 0 || s.ConnectAlert {
+		t.Errorf("expected the alert to be cleared after connecting, got %+v", s)
+	}
+}
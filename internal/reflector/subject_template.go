@@ -0,0 +1,64 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// subjectTemplateData is passed to the `subject.template` template
+type subjectTemplateData struct {
+	Subject string // original subject, with "Re:" in reply style
+	From    string // sender address
+	Date    string // date of the original, e.g. 02.01.2006
+}
+
+// parseSubjectTemplate parses the `subject.template` text. It also renders it once with empty
+// data, so references to unknown variables are reported as well.
+func parseSubjectTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("subject").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, subjectTemplateData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject.template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderSubjectTemplate renders `subject.template` for original, with subject being the
+// original subject as it would be forwarded without a template. It returns false when no
+// template is configured or it fails, in which case the caller falls back.
+func renderSubjectTemplate(original MailSummary, subject string) (string, bool) {
+	text := viper.GetString("subject.template")
+	if text == "" {
+		return "", false
+	}
+
+	tmpl, err := parseSubjectTemplate(text)
+	if err != nil {
+		slog.Warn("Could not parse subject template, falling back to the default subject", "error", err)
+		return "", false
+	}
+
+	date := original.InternalDate
+	if original.Envelope != nil && !original.Envelope.Date.IsZero() {
+		date = original.Envelope.Date
+	}
+	data := subjectTemplateData{Subject: subject, From: getFromAddress(original.Envelope)}
+	if !date.IsZero() {
+		data.Date = date.In(time.Local).Format("02.01.2006")
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		slog.Warn("Could not render subject template, falling back to the default subject", "error", err)
+		return "", false
+	}
+	return b.String(), true
+}
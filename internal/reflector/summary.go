@@ -0,0 +1,100 @@
+package reflector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// summaryCounts holds what happened to the messages processed since the last summary
+type summaryCounts struct {
+	Processed int
+	Forwarded int
+	Failed    int
+	Skipped   int
+	Since     time.Time
+}
+
+// pendingSummary collects the counts for the next `notify.summary_interval` notification
+var (
+	pendingSummary   = summaryCounts{Since: time.Now()}
+	pendingSummaryMu sync.Mutex
+)
+
+// summaryInterval returns the configured `notify.summary_interval`, or 0 if summaries are off
+func summaryInterval() time.Duration {
+	return max(viper.GetDuration("notify.summary_interval"), 0)
+}
+
+// recordSummary counts a processed message with the given outcome for the next summary
+func recordSummary(status string) {
+	pendingSummaryMu.Lock()
+	defer pendingSummaryMu.Unlock()
+	pendingSummary.Processed++
+	switch status {
+	case MessageForwarded:
+		pendingSummary.Forwarded++
+	case MessageFailed:
+		pendingSummary.Failed++
+	case MessageSkipped:
+		pendingSummary.Skipped++
+	}
+}
+
+// takeSummary returns the counts since the last summary and starts counting anew
+func takeSummary() summaryCounts {
+	pendingSummaryMu.Lock()
+	defer pendingSummaryMu.Unlock()
+	counts := pendingSummary
+	pendingSummary = summaryCounts{Since: time.Now()}
+	return counts
+}
+
+// String describes the counts, e.g. "Processed 12 messages in the last 1h0m0s: 11 forwarded,
+// 0 failed, 1 skipped"
+func (c summaryCounts) String() string {
+	return fmt.Sprintf("Processed %d messages in the last %v: %d forwarded, %d failed, %d skipped",
+		c.Processed, time.Since(c.Since).Round(time.Second), c.Forwarded, c.Failed, c.Skipped)
+}
+
+// sendSummary notifies the operators of the counts since the last summary
+func sendSummary() {
+	counts := takeSummary()
+	slog.Info("Sending summary notification", "processed", counts.Processed, "forwarded", counts.Forwarded,
+		"failed", counts.Failed, "skipped", counts.Skipped)
+	notify("summary", counts.String(), map[string]string{
+		"processed": strconv.Itoa(counts.Processed),
+		"forwarded": strconv.Itoa(counts.Forwarded),
+		"failed":    strconv.Itoa(counts.Failed),
+		"skipped":   strconv.Itoa(counts.Skipped),
+		"since":     counts.Since.Format(time.RFC3339),
+	})
+}
+
+// startSummaries sends a summary every `notify.summary_interval` until ctx is cancelled, as a
+// heartbeat showing that serve is alive and how it is doing
+func startSummaries(ctx context.Context) {
+	interval := summaryInterval()
+	if interval == 0 {
+		return
+	}
+
+	takeSummary() // count from now on
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sendSummary()
+			}
+		}
+	}()
+}
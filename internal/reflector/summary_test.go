@@ -0,0 +1,45 @@
+package reflector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSendSummary(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	var received notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if json.NewDecoder(r.Body).Decode(&n) == nil && n.Event == "summary" {
+			received = n
+		}
+	}))
+	t.Cleanup(srv.Close)
+	viper.Set("notify.webhook_url", srv.URL)
+
+	takeSummary()
+	recordSummary(MessageForwarded)
+	recordSummary(MessageForwarded)
+	recordSummary(MessageFailed)
+	recordSummary(MessageSkipped)
+	sendSummary()
+
+	if received.Event != "summary" {
+		t.Fatalf("unexpected notification %+v", received)
+	}
+	want := map[string]string{"processed": "4", "forwarded": "2", "failed": "1", "skipped": "1"}
+	for key, value := range want {
+		if received.Fields[key] != value {
+			t.Errorf("%s = %q, want %q", key, received.Fields[key], value)
+		}
+	}
+
+	if counts := takeSummary(); counts.Processed != 0 {
+		t.Errorf("counts should be reset after a summary, got %+v", counts)
+	}
+}
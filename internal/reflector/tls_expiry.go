@@ -0,0 +1,52 @@
+package reflector
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultCertExpiryWarn is how long before a server certificate expires a warning is logged
+const defaultCertExpiryWarn = 14 * 24 * time.Hour
+
+// certExpiryWarnWindow returns the configured `tls.expiry_warn` window (0 disables the check)
+func certExpiryWarnWindow() time.Duration {
+	if viper.IsSet("tls.expiry_warn") {
+		return viper.GetDuration("tls.expiry_warn")
+	}
+	return defaultCertExpiryWarn
+}
+
+// withCertExpiryCheck installs a hook on the TLS config that warns when the server's
+// certificate is about to expire, so operators can act before connections start failing
+func withCertExpiryCheck(cfg *tls.Config, service string) *tls.Config {
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		warnOnCertificateExpiry(service, state, time.Now())
+		return nil
+	}
+	return cfg
+}
+
+// warnOnCertificateExpiry logs a warning if the peer certificate expires within the warn window
+func warnOnCertificateExpiry(service string, state tls.ConnectionState, now time.Time) bool {
+	window := certExpiryWarnWindow()
+	if window <= 0 || len(state.PeerCertificates) == 0 {
+		return false
+	}
+
+	leaf := state.PeerCertificates[0]
+	remaining := leaf.NotAfter.Sub(now)
+	if remaining > window {
+		return false
+	}
+
+	slog.Warn("Server TLS certificate is about to expire",
+		"service", service,
+		"server", state.ServerName,
+		"subject", leaf.Subject.CommonName,
+		"not_after", leaf.NotAfter,
+		"remaining", remaining.Round(time.Hour))
+	return true
+}
@@ -0,0 +1,29 @@
+package reflector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestWarnOnCertificateExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stateExpiringIn := func(d time.Duration) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{{NotAfter: now.Add(d)}}}
+	}
+
+	if !warnOnCertificateExpiry("imap", stateExpiringIn(3*24*time.Hour), now) {
+		t.Errorf("expected a warning for a certificate expiring in 3 days")
+	}
+
+	if warnOnCertificateExpiry("imap", stateExpiringIn(90*24*time.Hour), now) {
+		t.Errorf("expected no warning for a certificate expiring in 90 days")
+	}
+
+	if warnOnCertificateExpiry("imap", tls.ConnectionState{}, now) {
+		t.Errorf("expected no warning without peer certificates")
+	}
+}
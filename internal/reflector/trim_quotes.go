@@ -0,0 +1,64 @@
+package reflector
+
+import (
+	"regexp"
+	"strings"
+)
+
+// replySeparators match the attribution lines mail clients put above quoted history.
+// Everything from such a line onward is considered old content.
+var replySeparators = []*regexp.Regexp{
+	regexp.MustCompile(`^On .+ wrote:$`),             // Gmail, Apple Mail, Thunderbird
+	regexp.MustCompile(`^Am .+ schrieb .+:$`),        // German clients
+	regexp.MustCompile(`^-+ ?Original Message ?-+$`), // Outlook
+	regexp.MustCompile(`^-+ ?Ursprüngliche Nachricht ?-+$`),
+}
+
+// trimQuotedReplies strips quoted reply history from a plain-text body, keeping only
+// the new content: lines starting with ">" are dropped, everything after a recognized
+// "On ... wrote:" separator is cut, and runs of blank lines are collapsed.
+func trimQuotedReplies(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var kept []string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		if isReplySeparator(line) {
+			break
+		}
+
+		// Attribution lines are often wrapped onto a second line by the sending client
+		if i+1 < len(lines) && isReplySeparator(line+" "+strings.TrimSpace(lines[i+1])) {
+			break
+		}
+
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+
+		// Collapse consecutive blank lines into one
+		if line == "" && len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+			continue
+		}
+
+		kept = append(kept, strings.TrimRight(lines[i], " \t"))
+	}
+
+	trimmed := strings.TrimSpace(strings.Join(kept, "\n"))
+	if trimmed == "" {
+		return ""
+	}
+
+	return trimmed + "\n"
+}
+
+// isReplySeparator checks whether a line introduces quoted reply history
+func isReplySeparator(line string) bool {
+	for _, re := range replySeparators {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package reflector
+
+import "testing"
+
+func TestTrimQuotedReplies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "gmail attribution",
+			in:   "Thanks, see you Friday.\n\nOn Mon, Jan 8, 2024 at 10:00 AM Jane Doe <jane@example.com> wrote:\n> Are we meeting?\n> Jane\n",
+			want: "Thanks, see you Friday.\n",
+		},
+		{
+			name: "wrapped attribution",
+			in:   "Agreed.\n\nOn Mon, Jan 8, 2024 at 10:00 AM Jane Doe\n<jane@example.com> wrote:\n\n> Proposal attached.\n",
+			want: "Agreed.\n",
+		},
+		{
+			name: "german attribution",
+			in:   "Danke!\n\nAm 08.01.2024 um 10:00 schrieb Max Mustermann <max@example.de>:\n> Hallo zusammen\n",
+			want: "Danke!\n",
+		},
+		{
+			name: "outlook original message",
+			in:   "Please find the minutes below.\r\n\r\n-----Original Message-----\r\nFrom: Board\r\nSubject: Minutes\r\n",
+			want: "Please find the minutes below.\n",
+		},
+		{
+			name: "interleaved quotes and collapsed blank lines",
+			in:   "> first question\nAnswer one.\n\n\n\n> second question\nAnswer two.\n",
+			want: "Answer one.\n\nAnswer two.\n",
+		},
+		{
+			name: "no quotes",
+			in:   "Just a plain announcement.\n",
+			want: "Just a plain announcement.\n",
+		},
+		{
+			name: "only quotes",
+			in:   "> nothing new\n",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := trimQuotedReplies(tt.in); got != tt.want {
+				t.Errorf("trimQuotedReplies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
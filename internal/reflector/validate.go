@@ -0,0 +1,159 @@
+package reflector
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidateConfig checks the loaded configuration for errors that would make forwarding fail,
+// so commands can refuse to start instead of failing on every message
+func ValidateConfig() []error {
+	var errs []error
+
+	required := []string{"imap.server", "imap.username", "imap.password", "smtp.server", "smtp.username"}
+	if imapAuthMethod() == imapAuthXOAuth2 {
+		required[2] = "imap.oauth.access_token"
+	}
+	for _, key := range required {
+		if viper.GetString(key) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+		}
+	}
+	for _, key := range []string{"imap.port", "smtp.port"} {
+		if port := viper.GetInt(key); port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a valid port, got %d", key, port))
+		}
+	}
+
+	subjectPatterns := viper.GetStringSlice("filter.subject")
+	if len(viper.GetStringSlice("filter.from")) == 0 && len(subjectPatterns) == 0 {
+		errs = append(errs, fmt.Errorf("filter.from must contain at least one sender (or filter.subject a pattern)"))
+	}
+	for i, p := range subjectPatterns {
+		if _, err := compileSubjectPattern(p); err != nil {
+			errs = append(errs, fmt.Errorf("filter.subject[%d]: invalid regular expression %q: %w", i, p, err))
+		}
+	}
+
+	for i, p := range viper.GetStringSlice("filter.attachment_name") {
+		if _, err := compileAttachmentNamePattern(p); err != nil {
+			errs = append(errs, fmt.Errorf("filter.attachment_name[%d]: invalid regular expression %q: %w", i, p, err))
+		}
+	}
+
+	recipients := viper.GetStringSlice("recipients")
+	if len(recipients) == 0 {
+		errs = append(errs, fmt.Errorf("recipients must contain at least one address"))
+	}
+	for i, r := range recipients {
+		if _, err := mail.ParseAddress(r); err != nil {
+			errs = append(errs, fmt.Errorf("recipients[%d]: invalid address %q: %w", i, r, err))
+		}
+	}
+	if len(recipients) > 0 && len(allowedRecipients(recipients)) == 0 {
+		errs = append(errs, fmt.Errorf("recipient_domains: no recipient is in an allowed, unblocked domain"))
+	}
+
+	if prefix := viper.GetString("subject.prefix"); prefix != sanitizeHeaderValue(prefix) {
+		errs = append(errs, fmt.Errorf("subject.prefix must not contain line breaks, control characters or surrounding spaces, got %q", prefix))
+	}
+
+	if text := viper.GetString("subject.template"); text != "" {
+		if _, err := parseSubjectTemplate(text); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if envFrom := viper.GetString("smtp.envelope_from"); envFrom != "" {
+		if addr, err := mail.ParseAddress(envFrom); err != nil || addr.Name != "" {
+			errs = append(errs, fmt.Errorf("smtp.envelope_from must be a bare address, got %q", envFrom))
+		}
+	}
+
+	if redirect := redirectAddress(); redirect != "" {
+		if addr, err := mail.ParseAddress(redirect); err != nil || addr.Name != "" {
+			errs = append(errs, fmt.Errorf("forward.redirect_to must be a bare address, got %q", redirect))
+		}
+	}
+
+	if viper.GetString("confirm.mode") == confirmWebhook && viper.GetString("confirm.webhook_url") == "" {
+		errs = append(errs, fmt.Errorf("confirm.webhook_url is required with confirm.mode: webhook"))
+	}
+
+	if viper.GetBool("processing.use_high_water_mark") && viper.GetString("state.file") == "" {
+		errs = append(errs, fmt.Errorf("processing.use_high_water_mark requires state.file"))
+	}
+
+	if viper.GetString("scan.policy") == scanQuarantine && viper.GetString("scan.quarantine_folder") == "" {
+		errs = append(errs, fmt.Errorf("scan.quarantine_folder is required with scan.policy: quarantine"))
+	}
+
+	if parseFailurePolicy() == parseFailureNotify && !notificationsConfigured() {
+		errs = append(errs, fmt.Errorf("forward.on_parse_failure: notify requires notify.webhook_url or notify.email"))
+	}
+
+	if encryptedPolicy() == encryptedNotify && !notificationsConfigured() {
+		errs = append(errs, fmt.Errorf("forward.encrypted_policy: notify requires notify.webhook_url or notify.email"))
+	}
+
+	if contentDedupEnabled() && viper.GetString("state.file") == "" {
+		errs = append(errs, fmt.Errorf("dedup.by_content_hash requires state.file"))
+	}
+
+	if summaryInterval() > 0 && !notificationsConfigured() {
+		errs = append(errs, fmt.Errorf("notify.summary_interval: requires notify.webhook_url or notify.email"))
+	}
+
+	if spec := viper.GetString("serve.schedule"); spec != "" {
+		if _, err := parseSchedule(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if (viper.GetString("web.username") == "") != (viper.GetString("web.password_hash") == "") {
+		errs = append(errs, fmt.Errorf("web.username and web.password_hash must be set together"))
+	} else if hash := viper.GetString("web.password_hash"); hash != "" {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			errs = append(errs, fmt.Errorf("web.password_hash must be a bcrypt hash: %w", err))
+		}
+	}
+
+	errs = append(errs, ValidateFromMap()...)
+	if HasAccounts() {
+		errs = append(errs, ValidateAccounts()...)
+	}
+
+	// Options with a fixed set of values
+	choices := []struct {
+		key     string
+		allowed []string
+	}{
+		{"smtp.auth_mechanism", []string{smtpAuthAuto, smtpAuthPlain, smtpAuthLogin, smtpAuthCRAMMD5}},
+		{"imap.security", []string{"ssl", "tls", "starttls", "none"}},
+		{"imap.auth", []string{imapAuthPassword, imapAuthXOAuth2}},
+		{"serve.mode", []string{serveModeIdle, serveModePoll}},
+		{"scan.policy", []string{scanStrip, scanSkip, scanQuarantine}},
+		{"forward.encrypted_policy", []string{encryptedPassthrough, encryptedSkip, encryptedNotify}},
+		{"processing.backlog_policy", []string{backlogForwardAll, backlogForwardNewestN, backlogSkipAllMarkSeen, backlogIgnoreExisting}},
+		{"confirm.mode", []string{confirmImmediate, confirmWebhook}},
+		{"confirm.on_failure", []string{confirmFailureMark, confirmFailureRetry}},
+		{"fetch.oversize_policy", []string{fetchOversizeSkip, fetchOversizeReference}},
+		{"forward.mode", []string{forwardModeBcc, forwardModeTo, forwardModePassthrough}},
+		{"forward.style", []string{forwardStyleForward, forwardStyleReply}},
+		{"forward.reply_to", []string{"sender", "delivered_to"}},
+		{"forward.oversize_policy", []string{oversizeSkip, oversizePreview}},
+		{"forward.priority", []string{priorityLow, priorityNormal, priorityHigh, priorityPreserve}},
+		{"forward.on_parse_failure", []string{parseFailureSkip, parseFailureForwardRaw, parseFailureNotify}},
+	}
+	for _, c := range choices {
+		if v := viper.GetString(c.key); v != "" && !slices.Contains(c.allowed, v) {
+			errs = append(errs, fmt.Errorf("%s: unknown value %q (allowed: %v)", c.key, v, c.allowed))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,63 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidateConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("imap.server", "imap.example.com")
+	viper.Set("imap.port", 993)
+	viper.Set("imap.username", "board")
+	viper.Set("imap.password", "secret")
+	viper.Set("smtp.server", "smtp.example.com")
+	viper.Set("smtp.port", 465)
+	viper.Set("smtp.username", "board@example.com")
+	viper.Set("filter.from", []string{"vorstand@example.com"})
+	viper.Set("recipients", []string{"a@example.com", "B <b@example.com>"})
+
+	if errs := ValidateConfig(); len(errs) != 0 {
+		t.Fatalf("expected valid config, got %v", errs)
+	}
+
+	viper.Set("imap.password", "")
+	viper.Set("recipients", []string{"not-an-address"})
+	viper.Set("forward.style", "replay")
+
+	errs := ValidateConfig()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %d: %v", len(errs), errs)
+	}
+	for i, want := range []string{"imap.password", "recipients[0]", "forward.style"} {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], want)
+		}
+	}
+
+	// XOAUTH2 needs an access token instead of a password
+	viper.Set("recipients", []string{"a@example.com"})
+	viper.Set("forward.style", "")
+	viper.Set("imap.auth", "xoauth2")
+	errs = ValidateConfig()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "imap.oauth.access_token") {
+		t.Errorf("expected only the missing access token, got %v", errs)
+	}
+
+	// Web credentials need both a username and a bcrypt hash
+	viper.Set("imap.auth", "")
+	viper.Set("imap.password", "secret")
+	viper.Set("web.username", "admin")
+	viper.Set("web.password_hash", "secret")
+	errs = ValidateConfig()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "web.password_hash") {
+		t.Errorf("expected a plain-text password to be rejected, got %v", errs)
+	}
+	viper.Set("web.password_hash", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy")
+	if errs := ValidateConfig(); len(errs) != 0 {
+		t.Errorf("expected a bcrypt hash to be accepted, got %v", errs)
+	}
+}
@@ -0,0 +1,69 @@
+package reflector
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// wireLogger is an io.Writer that receives raw IMAP protocol traffic from go-imap's
+// debug hook and emits it line by line as slog debug records, with credentials redacted.
+type wireLogger struct {
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	pendingAuth bool // next client line is a SASL response that must be hidden
+}
+
+// newWireLogger creates a writer suitable for client.SetDebug
+func newWireLogger() *wireLogger {
+	return &wireLogger{}
+}
+
+// Write buffers the traffic and logs every complete line
+func (w *wireLogger) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Incomplete line, keep it for the next write
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		slog.Debug("IMAP wire", "line", w.redact(strings.TrimRight(line, "\r\n")))
+	}
+
+	return len(p), nil
+}
+
+// redact hides credentials from LOGIN and AUTHENTICATE exchanges
+func (w *wireLogger) redact(line string) string {
+	// SASL responses are sent as bare lines after a server continuation ("+ ...")
+	if w.pendingAuth && !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "*") {
+		if strings.Contains(line, " OK ") || strings.Contains(line, " NO ") || strings.Contains(line, " BAD ") {
+			w.pendingAuth = false
+			return line
+		}
+		return "<redacted>"
+	}
+
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 3 {
+		return line
+	}
+
+	switch strings.ToUpper(fields[1]) {
+	case "LOGIN":
+		return fields[0] + " " + fields[1] + " <redacted>"
+	case "AUTHENTICATE":
+		w.pendingAuth = true
+		mechanism, _, _ := strings.Cut(fields[2], " ")
+		return fields[0] + " " + fields[1] + " " + mechanism + " <redacted>"
+	}
+
+	return line
+}
@@ -0,0 +1,28 @@
+package reflector
+
+import "testing"
+
+func TestWireLogger_RedactsCredentials(t *testing.T) {
+	t.Parallel()
+
+	w := newWireLogger()
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`a1 LOGIN "user" "secret"`, `a1 LOGIN <redacted>`},
+		{`a2 SELECT INBOX`, `a2 SELECT INBOX`},
+		{`a3 AUTHENTICATE PLAIN AHVzZXIAc2VjcmV0`, `a3 AUTHENTICATE PLAIN <redacted>`},
+		{`+ `, `+ `},
+		{`AHVzZXIAc2VjcmV0`, `<redacted>`},
+		{`a3 OK Authenticated`, `a3 OK Authenticated`},
+		{`a4 NOOP`, `a4 NOOP`},
+	}
+
+	for _, tt := range tests {
+		if got := w.redact(tt.line); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
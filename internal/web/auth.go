@@ -0,0 +1,90 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// generatedUsername is the username when no `web.username` is configured
+const generatedUsername = "admin"
+
+// credentials protect every route except /healthz: `web.username` and `web.password_hash`
+// (a bcrypt hash, see `mail-reflector web hash-password`)
+type credentials struct {
+	username     string
+	passwordHash string
+}
+
+// loadCredentials reads the configured credentials. Without them, it generates a random
+// password for this run, which is returned so it can be shown to the operator once.
+func loadCredentials() (creds credentials, generatedPassword string) {
+	creds = credentials{
+		username:     viper.GetString("web.username"),
+		passwordHash: viper.GetString("web.password_hash"),
+	}
+	if creds.username != "" && creds.passwordHash != "" {
+		return creds, ""
+	}
+
+	buf := make([]byte, 18)
+	_, _ = rand.Read(buf) // never fails, see crypto/rand.Read
+	generatedPassword = base64.RawURLEncoding.EncodeToString(buf)
+	hash, _ := bcrypt.GenerateFromPassword([]byte(generatedPassword), bcrypt.DefaultCost) // only fails for passwords over 72 bytes
+	return credentials{username: generatedUsername, passwordHash: string(hash)}, generatedPassword
+}
+
+// HashPassword returns the bcrypt hash of password to use as `web.password_hash`
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// requireAuth serves next only to clients presenting the credentials via HTTP basic
+// authentication
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || !s.credentials.valid(username, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mail-reflector", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// valid reports whether username and password match the credentials
+func (c credentials) valid(username, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(c.username)) == 1
+	// The hash is always compared, so a wrong username takes as long as a wrong password
+	passOK := bcrypt.CompareHashAndPassword([]byte(c.passwordHash), []byte(password)) == nil
+	return userOK && passOK
+}
+
+// rejectCrossSite refuses requests sent by other sites' pages, which browsers would send with
+// the cached basic authentication credentials
+func rejectCrossSite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := r.Header.Get("Sec-Fetch-Site")
+		crossSite := site != "" && site != "same-origin" && site != "none"
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				crossSite = true
+			}
+		}
+		if crossSite {
+			http.Error(w, "cross-site request refused", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+)
+
+// defaultHealthCheckInterval is used when `web.health_check_interval` isn't set
+const defaultHealthCheckInterval = 5 * time.Minute
+
+// connectivityCache runs the IMAP/SMTP connectivity test in the background and keeps the last
+// result, so page loads don't open connections to the mail servers
+type connectivityCache struct {
+	check func() reflector.Connectivity
+
+	mu     sync.RWMutex
+	result *reflector.Connectivity
+}
+
+// run tests connectivity right away and then every interval until ctx is cancelled
+func (c *connectivityCache) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result := c.check()
+		c.mu.Lock()
+		c.result = &result
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// get returns the last result, or nil if no test has completed yet
+func (c *connectivityCache) get() *reflector.Connectivity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.result
+}
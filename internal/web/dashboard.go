@@ -0,0 +1,71 @@
+package web
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/spf13/viper"
+)
+
+// dashboardTemplate renders the monitoring page
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>mail-reflector</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td, th { padding: 0.3em 1em; text-align: left; }
+.ok { color: #1a7f37; } .failed { color: #cf222e; } .pending { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>mail-reflector</h1>
+{{if .Status.Enabled}}<form method="post" action="/pause"><button>Pause forwarding</button></form>
+{{else}}<p class="failed"><strong>Forwarding is paused</strong> (<code>enabled: false</code> or paused here): matching messages are left unseen.</p>
+<form method="post" action="/resume"><button>Resume forwarding</button></form>
+{{end}}{{if .Status.ConnectAlert}}<p class="failed"><strong>Connecting to the IMAP server failed {{.Status.ConnectFailures}} times in a row:</strong> {{.Status.LastConnectError}}</p>
+{{end}}<table>
+<tr><th>Service</th><th>Server</th><th>Status</th><th>Checked</th></tr>
+{{range .Services}}<tr>
+<td>{{.Name}}</td><td>{{.Server}}</td>
+{{if not .Check}}<td class="pending">&#9679; not checked yet</td><td></td>
+{{else if .Check.OK}}<td class="ok">&#9679; connected</td><td>{{.Check.CheckedAt.Format "2006-01-02 15:04:05"}}</td>
+{{else}}<td class="failed">&#9679; {{.Check.Error}}</td><td>{{.Check.CheckedAt.Format "2006-01-02 15:04:05"}}</td>
+{{end}}</tr>
+{{end}}</table>
+<p>Last mailbox check: {{if .Status.LastCheck.IsZero}}none yet{{else}}{{.Status.LastCheck.Format "2006-01-02 15:04:05"}}{{end}}</p>
+</body>
+</html>
+`))
+
+// dashboardService is one row of the dashboard
+type dashboardService struct {
+	Name   string
+	Server string
+	Check  *reflector.ServiceCheck
+}
+
+// handleDashboard shows the live IMAP/SMTP connectivity from the cached background check
+func (s *Server) handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	services := []dashboardService{
+		{Name: "IMAP", Server: viper.GetString("imap.server")},
+		{Name: "SMTP", Server: viper.GetString("smtp.server")},
+	}
+	if result := s.connectivity.get(); result != nil {
+		services[0].Check = &result.IMAP
+		services[1].Check = &result.SMTP
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, map[string]any{
+		"Services": services,
+		"Status":   reflector.CurrentStatus(),
+	})
+	if err != nil {
+		slog.Error("Failed to render dashboard", "error", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package web serves the HTTP endpoints of `serve`, such as the /healthz probe.
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/meko-christian/mail-reflector/internal/metrics"
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/spf13/viper"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish when the server stops
+const shutdownTimeout = 5 * time.Second
+
+// Server is the HTTP server started next to the serve loop
+type Server struct {
+	addr         string
+	mux          *http.ServeMux
+	connectivity *connectivityCache
+	credentials  credentials
+	// generatedPassword is the password generated for this run without configured credentials
+	generatedPassword string
+	// listMailboxes lists the folders for /mailboxes, replaceable in tests
+	listMailboxes func() ([]reflector.MailboxInfo, error)
+}
+
+// NewServer creates a server listening on addr (e.g. ":8080")
+func NewServer(addr string) *Server {
+	s := &Server{
+		addr:          addr,
+		mux:           http.NewServeMux(),
+		connectivity:  &connectivityCache{check: reflector.CheckConnectivity},
+		listMailboxes: reflector.ListMailboxes,
+	}
+	s.credentials, s.generatedPassword = loadCredentials()
+	// Unauthenticated, so container probes work without a session
+	s.mux.HandleFunc("GET /healthz", handleHealthz)
+	s.mux.Handle("GET /metrics", s.requireAuth(metrics.Handler()))
+	s.mux.Handle("GET /{$}", s.requireAuth(http.HandlerFunc(s.handleDashboard)))
+	s.mux.Handle("GET /mailboxes", s.requireAuth(http.HandlerFunc(s.handleMailboxes)))
+	s.mux.Handle("POST /pause", s.requireAuth(rejectCrossSite(http.HandlerFunc(handlePause))))
+	s.mux.Handle("POST /resume", s.requireAuth(rejectCrossSite(http.HandlerFunc(handleResume))))
+	return s
+}
+
+// GeneratedPassword returns the password generated for the "admin" user when no credentials
+// are configured, or "" if they are
+func (s *Server) GeneratedPassword() string {
+	return s.generatedPassword
+}
+
+// Handler returns the server's routes
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves HTTP until ctx is cancelled. It returns an error if the address can't be bound.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Test the mail servers in the background for the dashboard
+	interval := defaultHealthCheckInterval
+	if viper.IsSet("web.health_check_interval") {
+		interval = max(viper.GetDuration("web.health_check_interval"), time.Minute)
+	}
+	go s.connectivity.run(ctx, interval)
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Starting web server", "addr", ln.Addr().String())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleHealthz reports whether the last IMAP connection attempt succeeded and when the
+// mailbox was last checked
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(reflector.CurrentStatus())
+}
+
+// handleMailboxes lists the folders of the IMAP server with their (special-use) attributes
+func (s *Server) handleMailboxes(w http.ResponseWriter, _ *http.Request) {
+	mailboxes, err := s.listMailboxes()
+	if err != nil {
+		slog.Warn("Failed to list mailboxes", "error", err)
+		http.Error(w, "failed to list mailboxes: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(mailboxes)
+}
+
+// handlePause pauses forwarding until /resume or a restart, then shows the dashboard
+func handlePause(w http.ResponseWriter, r *http.Request) {
+	reflector.Pause()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleResume lifts a pause from /pause, then shows the dashboard
+func handleResume(w http.ResponseWriter, r *http.Request) {
+	reflector.Resume()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
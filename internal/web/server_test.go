@@ -0,0 +1,263 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meko-christian/mail-reflector/internal/reflector"
+	"github.com/spf13/viper"
+)
+
+func TestHealthz(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	NewServer(":0").Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", rec.Body.String(), err)
+	}
+	for _, key := range []string{"imap_connected", "last_connect_attempt", "last_check"} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("missing %q in %v", key, body)
+		}
+	}
+}
+
+// authRequest returns a GET request for path logged in with the password s generated
+func authRequest(s *Server, path string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetBasicAuth(generatedUsername, s.GeneratedPassword())
+	return req
+}
+
+func TestDashboard(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(":0")
+	s.connectivity.check = func() reflector.Connectivity {
+		return reflector.Connectivity{
+			IMAP: reflector.ServiceCheck{OK: true, CheckedAt: time.Now()},
+			SMTP: reflector.ServiceCheck{Error: "535 authentication failed", CheckedAt: time.Now()},
+		}
+	}
+
+	render := func() string {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, authRequest(s, "/"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	if body := render(); !strings.Contains(body, "not checked yet") {
+		t.Errorf("expected pending status before the first check:\n%s", body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // a single check, then stop
+	s.connectivity.run(ctx, time.Hour)
+
+	body := render()
+	if !strings.Contains(body, `class="ok"`) || !strings.Contains(body, "535 authentication failed") {
+		t.Errorf("expected IMAP connected and the SMTP error:\n%s", body)
+	}
+}
+
+func TestDashboardPaused(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("enabled", false)
+
+	s := NewServer(":0")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, authRequest(s, "/"))
+	if !strings.Contains(rec.Body.String(), "Forwarding is paused") {
+		t.Errorf("expected the dashboard to show that forwarding is paused:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(":0")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, authRequest(s, "/metrics"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for _, name := range []string{"mail_reflector_messages_forwarded_total", "mail_reflector_imap_connected", "mail_reflector_forward_duration_seconds_bucket"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("missing metric %s", name)
+		}
+	}
+}
+
+func TestMailboxes(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(":0")
+	s.listMailboxes = func() ([]reflector.MailboxInfo, error) {
+		return []reflector.MailboxInfo{{Name: "INBOX"}, {Name: "Sent", Attributes: []string{`\Sent`}}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mailboxes", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, authRequest(s, "/mailboxes"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	want := `[{"name":"INBOX"},{"name":"Sent","attributes":["\\Sent"]}]`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	s.listMailboxes = func() ([]reflector.MailboxInfo, error) {
+		return nil, errors.New("connection refused")
+	}
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, authRequest(s, "/mailboxes"))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 when the IMAP server is unreachable, got %d", rec.Code)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	get := func(s *Server, req *http.Request) int {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	request := func(path, username, password string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		return req
+	}
+
+	// Without configured credentials, a random password is generated for "admin"
+	generated := NewServer(":0")
+	password := generated.GeneratedPassword()
+	if len(password) < 20 {
+		t.Fatalf("expected a generated password, got %q", password)
+	}
+	if other := NewServer(":0").GeneratedPassword(); other == password {
+		t.Error("every run should generate a new password")
+	}
+	for _, path := range []string{"/", "/metrics"} {
+		if code := get(generated, request(path, "", "")); code != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: expected 401, got %d", path, code)
+		}
+	}
+	if code := get(generated, request("/metrics", generatedUsername, password)); code != http.StatusOK {
+		t.Errorf("expected the generated password to be accepted, got %d", code)
+	}
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	s := NewServer(":0")
+	s.credentials = credentials{username: "board", passwordHash: hash}
+
+	tests := []struct {
+		name               string
+		username, password string
+		want               int
+	}{
+		{"valid", "board", "secret", http.StatusOK},
+		{"wrong password", "board", "wrong", http.StatusUnauthorized},
+		{"wrong username", "admin", "secret", http.StatusUnauthorized},
+		{"none", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := get(s, request("/metrics", tt.username, tt.password)); code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, code)
+		}
+	}
+	if code := get(s, request("/healthz", "", "")); code != http.StatusOK {
+		t.Errorf("/healthz must not require authentication, got %d", code)
+	}
+}
+
+func TestConfiguredCredentials(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	viper.Set("web.username", "board")
+	viper.Set("web.password_hash", hash)
+
+	s := NewServer(":0")
+	if s.GeneratedPassword() != "" {
+		t.Error("no password should be generated when credentials are configured")
+	}
+	if !s.credentials.valid("board", "secret") {
+		t.Error("expected the configured credentials to be accepted")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	t.Cleanup(reflector.Resume)
+
+	s := NewServer(":0")
+	post := func(path string, authenticated bool, header map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if authenticated {
+			req.SetBasicAuth(generatedUsername, s.GeneratedPassword())
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("/pause", false, nil); code != http.StatusUnauthorized || !reflector.CurrentStatus().Enabled {
+		t.Fatalf("pausing without credentials: expected 401 and forwarding still enabled, got %d", code)
+	}
+	if code := post("/pause", true, map[string]string{"Origin": "https://evil.example"}); code != http.StatusForbidden || !reflector.CurrentStatus().Enabled {
+		t.Fatalf("pausing from another site: expected 403 and forwarding still enabled, got %d", code)
+	}
+
+	if code := post("/pause", true, nil); code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to the dashboard, got %d", code)
+	}
+	if reflector.CurrentStatus().Enabled {
+		t.Error("expected forwarding to be paused")
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, authRequest(s, "/"))
+	if !strings.Contains(rec.Body.String(), "Resume forwarding") {
+		t.Errorf("expected the dashboard to offer resuming:\n%s", rec.Body.String())
+	}
+
+	if code := post("/resume", true, map[string]string{"Sec-Fetch-Site": "same-origin"}); code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to the dashboard, got %d", code)
+	}
+	if !reflector.CurrentStatus().Enabled {
+		t.Error("expected forwarding to be resumed")
+	}
+}